@@ -17,10 +17,14 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 
 	"github.com/go-logr/logr"
@@ -28,6 +32,7 @@ import (
 	tektonv1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
@@ -37,48 +42,136 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 func namespace() string {
 	return os.Getenv("NAMESPACE")
 }
 
-func SetupStateWithManager(manager manager.Manager, configPath string) error {
+func SetupStateWithManager(manager manager.Manager, configPath string, reloadInterval time.Duration, role shield.Role, tlsOpts []func(*tls.Config)) error {
 	client := manager.GetClient()
-	cfg, err := shield.GetConfig(ctrl.Log, configPath)
+	cfg, err := shield.GetConfig(ctrl.Log, configPath, role)
 	if err != nil {
 		return fmt.Errorf("failed to fetch config: %s", err)
 	}
 
-	prom, err := shield.NewPrometheus(cfg.Prometheus.Address, cfg.Prometheus.Config)
-	if err != nil {
-		return fmt.Errorf("failed to setup prometheus connection: %s", err)
-	}
-
-	state := shield.NewState(client, types.NamespacedName{
+	ref := types.NamespacedName{
 		Namespace: cfg.DestNamespace,
 		Name:      cfg.DestName,
-	})
+	}
+	state := shield.NewState(client, ref)
 
-	querier := shield.NewQuerier(prom, state, *cfg)
+	reloaders := []shield.Reloader{}
 
-	err = manager.Add(querier)
-	if err != nil {
-		return fmt.Errorf("failed to register prometheus querier: %s", err)
+	if role.RunsQuerier() {
+		prom, err := shield.NewSource(*cfg)
+		if err != nil {
+			return fmt.Errorf("failed to setup signal source: %s", err)
+		}
+
+		querier := shield.NewQuerier(prom, state, *cfg)
+		err = manager.Add(querier)
+		if err != nil {
+			return fmt.Errorf("failed to register prometheus querier: %s", err)
+		}
+		reloaders = append(reloaders, querier)
+
+		if cfg.Receiver != nil {
+			err = manager.Add(shield.NewReceiver(querier, *cfg.Receiver, tlsOpts...))
+			if err != nil {
+				return fmt.Errorf("failed to register alertmanager receiver: %s", err)
+			}
+		}
+
+		if cfg.Queue.Enabled {
+			releaser := shield.NewReleaser(client, manager.GetAPIReader(), state, *cfg)
+			err = manager.Add(releaser)
+			if err != nil {
+				return fmt.Errorf("failed to register pipelinerun releaser: %s", err)
+			}
+			reloaders = append(reloaders, releaser)
+		}
+	}
+
+	if role.RunsWebhook() {
+		webhookState, err := setupWebhookState(manager, cfg, state, ref)
+		if err != nil {
+			return err
+		}
+
+		webhook, err := shield.NewWebhook(webhookState, *cfg, client)
+		if err != nil {
+			return fmt.Errorf("failed to setup pipelinerun webhook: %s", err)
+		}
+		reloaders = append(reloaders, webhook)
+
+		server := manager.GetWebhookServer()
+		for _, resource := range cfg.Resources {
+			handler := webhook.Handler(resource.GroupVersionKind())
+			server.Register(resource.Path, &admission.Webhook{Handler: handler})
+		}
+
+		if cfg.Queue.Enabled {
+			err = ctrl.NewWebhookManagedBy(manager).
+				For(&tektonv1.PipelineRun{}).
+				WithDefaulter(webhook).
+				Complete()
+			if err != nil {
+				ctrl.Log.Error(err, "unable to setup pipelinerun webhooks")
+				os.Exit(1)
+			}
+		}
 	}
 
-	err = ctrl.NewWebhookManagedBy(manager).
-		For(&tektonv1.PipelineRun{}).
-		WithValidator(shield.NewWebhook(state)).
-		Complete()
+	if reloadInterval == 0 {
+		// reloading is disabled
+		return nil
+	}
+	watcher, err := shield.NewConfigWatcher(configPath, reloadInterval, role, cfg, reloaders...)
 	if err != nil {
-		ctrl.Log.Error(err, "unable to setup pipelinerun webhooks")
-		os.Exit(1)
+		return fmt.Errorf("failed to watch config: %s", err)
+	}
+	err = manager.Add(watcher)
+	if err != nil {
+		return fmt.Errorf("failed to register config watcher: %s", err)
 	}
 
 	return nil
 }
 
+// setupWebhookState picks where admission reads the state from: the mounted
+// state file if configured, otherwise an in-memory snapshot kept up to date by
+// the cache.
+func setupWebhookState(manager manager.Manager, cfg *shield.Config, state shield.StateManager, ref types.NamespacedName) (shield.StateManager, error) {
+	if cfg.StateFile != nil {
+		fileState, err := shield.NewFileState(cfg.StateFile.Path, cfg.StateFile.Interval.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the state file: %s", err)
+		}
+		err = manager.Add(fileState)
+		if err != nil {
+			return nil, fmt.Errorf("failed to register the state file watcher: %s", err)
+		}
+		return fileState, nil
+	}
+
+	snapshot := shield.NewStateSnapshot(state, ref)
+	informer, err := manager.GetCache().GetInformer(context.Background(), &corev1.ConfigMap{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch the state: %s", err)
+	}
+	registration, err := informer.AddEventHandler(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch the state: %s", err)
+	}
+	err = manager.Add(snapshot.WaitForSync(registration.HasSynced))
+	if err != nil {
+		return nil, fmt.Errorf("failed to register the state snapshot: %s", err)
+	}
+	return snapshot, nil
+}
+
 func loadTLSCert(l *logr.Logger, certPath, keyPath string) func(*tls.Config) {
 	getCertificate := func(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
 		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
@@ -95,19 +188,86 @@ func loadTLSCert(l *logr.Logger, certPath, keyPath string) func(*tls.Config) {
 	}
 }
 
+// validateConfig implements the validate-config subcommand, returning the
+// process exit code.
+func validateConfig(args []string) int {
+	flags := flag.NewFlagSet("validate-config", flag.ContinueOnError)
+	roleName := flags.String("role", string(shield.RoleAll), "Role to validate the config for: all, querier or webhook.")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: etcd-shield validate-config [-role=all|querier|webhook] <file>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	role, ok := shield.ParseRole(*roleName)
+	if !ok || flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	path := flags.Arg(0)
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read config: %s\n", err)
+		return 1
+	}
+
+	_, err = shield.ParseConfig(contents, role)
+	if err != nil {
+		var agg utilerrors.Aggregate
+		if errors.As(err, &agg) {
+			for _, err := range agg.Errors() {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+		}
+		return 1
+	}
+
+	fmt.Printf("%s: config is valid\n", path)
+	return 0
+}
+
+// parseCommand picks the subcommand out of args, returning the role to run
+// and the remaining arguments.  Without a subcommand, every role is run.
+func parseCommand(args []string) (shield.Role, []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return shield.RoleAll, args
+	}
+
+	if args[0] == "validate-config" {
+		os.Exit(validateConfig(args[1:]))
+	}
+
+	role, ok := shield.ParseRole(args[0])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q, expected one of: all, querier, webhook, validate-config\n", args[0])
+		os.Exit(2)
+	}
+	return role, args[1:]
+}
+
 func main() {
+	role, args := parseCommand(os.Args[1:])
+
 	var enableLeaderElection bool
 	var probeAddr string
+	var metricsAddr string
 	var webhookPort int
 	var tlsCert string
 	var tlsKey string
 	var configPath string
-	flag.BoolVar(&enableLeaderElection, "leader-elect", false, "Enable leader election.")
+	var reloadInterval time.Duration
+	flag.BoolVar(&enableLeaderElection, "leader-elect", false, "Enable leader election.  Ignored by the webhook role.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.StringVar(&metricsAddr, "metrics-bind-address", ":9100", "The address the metrics endpoint binds to.")
 	flag.IntVar(&webhookPort, "port", 9443, "Port to listen for webhook events on.")
 	flag.StringVar(&tlsCert, "tls-cert", "/var/tls/tls.crt", "File location of tls certificate.")
 	flag.StringVar(&tlsKey, "tls-key", "/var/tls/tls.key", "File location of tls key pair.")
 	flag.StringVar(&configPath, "config", "/etc/etcd-shield/config.yaml", "Location of etcd-shield config")
+	flag.DurationVar(&reloadInterval, "config-reload-interval", 10*time.Second, "How often to check the config for changes, 0 to disable reloading.")
 
 	scheme := runtime.NewScheme()
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
@@ -118,7 +278,20 @@ func main() {
 	}
 	opts.BindFlags(flag.CommandLine)
 
-	flag.Parse()
+	if err := flag.CommandLine.Parse(args); err != nil {
+		os.Exit(2)
+	}
+	if flag.NArg() > 0 {
+		// the command has to come before any flags
+		fmt.Fprintf(os.Stderr, "unexpected arguments %q, the command has to come before any flags\n", flag.Args())
+		flag.Usage()
+		os.Exit(2)
+	}
+	if reloadInterval < 0 {
+		fmt.Fprintf(os.Stderr, "invalid -config-reload-interval %s, it must not be negative\n", reloadInterval)
+		flag.Usage()
+		os.Exit(2)
+	}
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
 	ctx := logr.NewContext(context.Background(), ctrl.Log)
@@ -131,13 +304,15 @@ func main() {
 				namespace(): {},
 			},
 		},
-		Scheme:                 scheme,
-		Logger:                 ctrl.Log,
-		BaseContext:            func() context.Context { return ctx },
-		LeaderElection:         enableLeaderElection,
+		Scheme:      scheme,
+		Logger:      ctrl.Log,
+		BaseContext: func() context.Context { return ctx },
+		// webhooks only read the state, so every replica serves on its own
+		LeaderElection:         enableLeaderElection && role.RunsQuerier(),
 		LeaderElectionID:       "etcd-shield.konflux-ci.dev",
 		HealthProbeBindAddress: probeAddr,
 		Metrics: server.Options{
+			BindAddress:    metricsAddr,
 			FilterProvider: filters.WithAuthenticationAndAuthorization,
 			SecureServing:  true,
 			TLSOpts:        tlsOpts,
@@ -163,7 +338,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err := SetupStateWithManager(mgr, configPath); err != nil {
+	if err := SetupStateWithManager(mgr, configPath, reloadInterval, role, tlsOpts); err != nil {
 		ctrl.Log.Error(err, "failed to setup state with manager")
 		os.Exit(1)
 	}
@@ -0,0 +1,156 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+)
+
+// Alertmanager is a PromQuery backed by the Alertmanager v2 API, so alerts from
+// every Prometheus and Thanos Ruler feeding it are seen.  Silenced and
+// inhibited alerts aren't firing, which lets a silence act as an operator
+// override.
+type Alertmanager struct {
+	address  string
+	matchers []*LabelMatcher
+	client   *http.Client
+}
+
+var _ PromQuery = &Alertmanager{}
+
+// NewAlertmanager creates an Alertmanager client.  Alerts must match every one
+// of matchers, such as `cluster="stone-prd-1"`, as well as their name.
+func NewAlertmanager(address string, matchers []string, cfg config.HTTPClientConfig) (PromQuery, error) {
+	parsed, err := ParseMatchers(matchers)
+	if err != nil {
+		return nil, err
+	}
+	client, err := config.NewClientFromConfig(cfg, "alertmanager")
+	if err != nil {
+		return nil, err
+	}
+	return &Alertmanager{
+		address:  strings.TrimSuffix(address, "/"),
+		matchers: parsed,
+		client:   client,
+	}, nil
+}
+
+// gettableAlert is the part of an Alertmanager v2 alert we need.
+type gettableAlert struct {
+	Labels model.LabelSet `json:"labels"`
+	Status struct {
+		State string `json:"state"`
+	} `json:"status"`
+}
+
+// IsAlertFiring indicates whether an alert with the name, matching the
+// configured matchers, is active and neither silenced nor inhibited.
+func (a *Alertmanager) IsAlertFiring(ctx context.Context, alertName string) (bool, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	matchers := append([]*LabelMatcher{{Name: model.AlertNameLabel, Type: MatchEqual, Value: alertName}}, a.matchers...)
+
+	start := time.Now()
+	alerts, err := a.alerts(ctx, matchers)
+	recordQuery("alertmanager", start, err)
+	if err != nil {
+		log.Error(err, "Error querying alertmanager for active alerts")
+		return false, err
+	}
+
+	// the filter is applied by alertmanager too, but don't rely on a proxy in
+	// between passing it along
+	for _, alert := range alerts {
+		if alert.Status.State == "active" && matchesAll(matchers, alert.Labels) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// FiringAlerts returns the labels of every alert matching the configured
+// matchers that is active and neither silenced nor inhibited.
+func (a *Alertmanager) FiringAlerts(ctx context.Context) ([]model.LabelSet, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	start := time.Now()
+	alerts, err := a.alerts(ctx, a.matchers)
+	recordQuery("alertmanager", start, err)
+	if err != nil {
+		log.Error(err, "Error querying alertmanager for active alerts")
+		return nil, err
+	}
+
+	firing := []model.LabelSet{}
+	for _, alert := range alerts {
+		if alert.Status.State == "active" && matchesAll(a.matchers, alert.Labels) {
+			firing = append(firing, alert.Labels)
+		}
+	}
+	return firing, nil
+}
+
+// QueryValue isn't supported, since alertmanager only knows about alerts.
+func (a *Alertmanager) QueryValue(_ context.Context, query string) (float64, error) {
+	return 0, fmt.Errorf("query %q can't be run against alertmanager", query)
+}
+
+func (a *Alertmanager) alerts(ctx context.Context, matchers []*LabelMatcher) ([]gettableAlert, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	params := url.Values{}
+	params.Set("active", "true")
+	params.Set("silenced", "false")
+	params.Set("inhibited", "false")
+	params.Set("unprocessed", "false")
+	for _, m := range matchers {
+		params.Add("filter", m.String())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.address+"/api/v2/alerts?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	alerts := []gettableAlert{}
+	if err := json.NewDecoder(resp.Body).Decode(&alerts); err != nil {
+		return nil, fmt.Errorf("failed to decode alerts: %w", err)
+	}
+	return alerts, nil
+}
+
+// QueryRange isn't supported.
+func (a *Alertmanager) QueryRange(_ context.Context, query string, _, _ time.Time, _ time.Duration) ([]model.SamplePair, error) {
+	return nil, fmt.Errorf("query %q can't be run against alertmanager", query)
+}
@@ -0,0 +1,120 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	etcd_shield "github.com/konflux-ci/etcd-shield/pkg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/common/config"
+)
+
+// amAlert is an alert as returned by the Alertmanager v2 API.
+type amAlert struct {
+	Labels map[string]string `json:"labels"`
+	Status struct {
+		State string `json:"state"`
+	} `json:"status"`
+}
+
+func alert(state string, labels map[string]string) amAlert {
+	a := amAlert{Labels: labels}
+	a.Status.State = state
+	return a
+}
+
+var _ = Describe("Pkg/Alertmanager", func() {
+	var alerts []amAlert
+	var query url.Values
+	var server *httptest.Server
+
+	BeforeEach(func() {
+		alerts = []amAlert{}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/v2/alerts" {
+				http.NotFound(w, r)
+				return
+			}
+			query = r.URL.Query()
+			_ = json.NewEncoder(w).Encode(alerts)
+		}))
+		DeferCleanup(server.Close)
+	})
+
+	source := func(matchers ...string) etcd_shield.PromQuery {
+		am, err := etcd_shield.NewAlertmanager(server.URL, matchers, config.HTTPClientConfig{})
+		Expect(err).NotTo(HaveOccurred())
+		return am
+	}
+
+	It("Should only ask for active alerts that aren't silenced or inhibited", func(ctx context.Context) {
+		am := source(`cluster="stone-prd-1"`)
+		Expect(am.IsAlertFiring(ctx, "EtcdDBSizeHigh")).To(BeFalse())
+		Expect(query.Get("active")).To(Equal("true"))
+		Expect(query.Get("silenced")).To(Equal("false"))
+		Expect(query.Get("inhibited")).To(Equal("false"))
+		Expect(query["filter"]).To(ConsistOf(`alertname="EtcdDBSizeHigh"`, `cluster="stone-prd-1"`))
+	})
+
+	It("Should match the alert name and labels", func(ctx context.Context) {
+		am := source(`cluster="stone-prd-1"`)
+		alerts = append(alerts, alert("active", map[string]string{"alertname": "EtcdDBSizeHigh", "cluster": "stone-prd-2"}))
+		Expect(am.IsAlertFiring(ctx, "EtcdDBSizeHigh")).To(BeFalse())
+
+		alerts = append(alerts, alert("active", map[string]string{"alertname": "EtcdDBSizeHigh", "cluster": "stone-prd-1"}))
+		Expect(am.IsAlertFiring(ctx, "EtcdDBSizeHigh")).To(BeTrue())
+		Expect(am.IsAlertFiring(ctx, "EtcdNoSpaceAlarm")).To(BeFalse())
+	})
+
+	It("Should ignore suppressed alerts", func(ctx context.Context) {
+		am := source()
+		alerts = append(alerts, alert("suppressed", map[string]string{"alertname": "EtcdDBSizeHigh"}))
+		Expect(am.IsAlertFiring(ctx, "EtcdDBSizeHigh")).To(BeFalse())
+	})
+
+	It("Should fail when alertmanager does", func(ctx context.Context) {
+		am, err := etcd_shield.NewAlertmanager(server.URL+"/missing", nil, config.HTTPClientConfig{})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = am.IsAlertFiring(ctx, "EtcdDBSizeHigh")
+		Expect(err).To(HaveOccurred())
+	})
+
+	DescribeTable("Should parse label matchers",
+		func(matcher, value string, matches bool) {
+			m, err := etcd_shield.ParseMatcher(matcher)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(m.Matches(value)).To(Equal(matches))
+		},
+		Entry("equal", `cluster="stone-prd-1"`, "stone-prd-1", true),
+		Entry("unquoted", `cluster=stone-prd-1`, "stone-prd-2", false),
+		Entry("not equal", `cluster!="stone-prd-1"`, "stone-prd-2", true),
+		Entry("regexp is anchored", `cluster=~"stone-prd-.*"`, "a-stone-prd-1", false),
+		Entry("regexp", `cluster=~"stone-prd-.*"`, "stone-prd-1", true),
+		Entry("not regexp", `cluster!~"stone-prd-.*"`, "stone-stg-1", true),
+	)
+
+	It("Should reject invalid matchers", func() {
+		for _, matcher := range []string{`cluster`, `="x"`, `cluster=~"("`, `cluster="x`} {
+			_, err := etcd_shield.ParseMatcher(matcher)
+			Expect(err).To(HaveOccurred(), matcher)
+		}
+	})
+})
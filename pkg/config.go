@@ -15,10 +15,20 @@
 package etcd_shield
 
 import (
+	"net/http"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/prometheus/common/config"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"sigs.k8s.io/yaml"
 )
 
@@ -29,38 +39,1198 @@ type Config struct {
 	// DestNamespace is the namespace of the ConfigMap to write our state to
 	DestNamespace string `json:"destNamespace"`
 
+	// Source selects where the querier gets its signals from.  Defaults to
+	// prometheus.
+	Source SourceType `json:"source,omitempty"`
+
 	// Prometheus specifies how to talk to a service that speaks the prometheus HTTP API.
+	// Its alert, query and thresholds are used whatever the Source.
 	Prometheus PrometheusConfig `json:"prometheus"`
 
+	// EtcdMetrics specifies how to scrape etcd members directly.  Required when
+	// Source is etcdMetrics.
+	EtcdMetrics *EtcdMetricsConfig `json:"etcdMetrics,omitempty"`
+
+	// EtcdStatus specifies how to reach etcd members' maintenance API.
+	// Required when Source is etcdStatus, and can be set alongside another
+	// Source to act on etcd's own alarms.
+	EtcdStatus *EtcdStatusConfig `json:"etcdStatus,omitempty"`
+
+	// Alertmanager specifies how to reach the Alertmanager v2 API.  Required
+	// when Source is alertmanager.
+	Alertmanager *AlertmanagerConfig `json:"alertmanager,omitempty"`
+
 	// WaitTime is how long we'll wait before checking prometheus again.
 	WaitTime Duration `json:"waitTime"`
+
+	// Throttle configures the throttled admission level, which sits between
+	// admitting and denying every `PipelineRun`.  Throttling is disabled if unset.
+	Throttle *ThrottleConfig `json:"throttle,omitempty"`
+
+	// Resources lists the kinds of objects the webhooks guard, each served on
+	// its own path.  Defaults to Tekton v1 `PipelineRuns`.
+	Resources []ResourceConfig `json:"resources,omitempty"`
+
+	// Denial configures the responses the webhooks deny objects with.
+	Denial DenialConfig `json:"denial,omitempty"`
+
+	// Exemptions describes `PipelineRuns` that are always admitted, regardless of
+	// the admission level.
+	Exemptions ExemptionConfig `json:"exemptions,omitempty"`
+
+	// Queue configures holding back `PipelineRuns` as pending while admission is
+	// closed, instead of rejecting them.
+	Queue QueueConfig `json:"queue,omitempty"`
+
+	// StateFile makes the webhooks read the state from a mounted copy of the
+	// state ConfigMap instead of the API server.  Unset by default.
+	StateFile *StateFileConfig `json:"stateFile,omitempty"`
+
+	// Staleness configures what the webhooks do when the querier stops
+	// refreshing the state.
+	Staleness StalenessConfig `json:"staleness,omitempty"`
+
+	// Damping configures how readily the querier changes the level, to keep
+	// noisy signals from flapping admission.
+	Damping DampingConfig `json:"damping,omitempty"`
+
+	// Ramp configures admitting a growing fraction of `PipelineRuns` for a
+	// while after admission reopens, instead of all of them at once.
+	// Disabled if unset.
+	Ramp *RampConfig `json:"ramp,omitempty"`
+
+	// Quota configures how etcd's quota is found, which thresholds given as
+	// percentages are relative to.
+	Quota QuotaConfig `json:"quota,omitempty"`
+
+	// Prediction closes admission when the database is projected to reach its
+	// quota soon, ahead of any threshold.  Disabled if unset.
+	Prediction *PredictionConfig `json:"prediction,omitempty"`
+
+	// Receiver configures an Alertmanager webhook receiver that makes the
+	// querier check the signals as soon as alerts fire or resolve.  Disabled
+	// if unset.
+	Receiver *ReceiverConfig `json:"receiver,omitempty"`
 }
 
+// SourceType is a kind of signal source the querier can use.
+type SourceType string
+
+const (
+	// SourcePrometheus queries the prometheus HTTP API.
+	SourcePrometheus SourceType = "prometheus"
+	// SourceEtcdMetrics scrapes the metrics endpoints of etcd members directly.
+	SourceEtcdMetrics SourceType = "etcdMetrics"
+	// SourceEtcdStatus calls the maintenance Status API of etcd members
+	// directly.
+	SourceEtcdStatus SourceType = "etcdStatus"
+	// SourceAlertmanager checks alerts through the Alertmanager v2 API.
+	SourceAlertmanager SourceType = "alertmanager"
+)
+
+// EndpointStrategy is how several prometheus endpoints are used together.
+type EndpointStrategy string
+
+const (
+	// StrategyFailover uses the first healthy endpoint, moving on to the next
+	// when it fails.
+	StrategyFailover EndpointStrategy = "failover"
+	// StrategyQuorum asks every endpoint, and needs a majority to agree.
+	StrategyQuorum EndpointStrategy = "quorum"
+)
+
 type PrometheusConfig struct {
 	// Address to make prometheus queries to
 	Address string `json:"address"`
 
-	// EnableIngressQuery is the prometheus query to run to determine if `PipelineRun`
-	// ingress will be allowed.  Should be mutually exclusive with SetQuery.
-	AlertName string `json:"alertName"`
+	// Addresses lists several prometheus or Thanos endpoints to use according
+	// to Strategy, instead of a single Address.
+	Addresses []string `json:"addresses,omitempty"`
+
+	// Strategy is how Addresses are used: failover (the default) or quorum.
+	Strategy EndpointStrategy `json:"strategy,omitempty"`
+
+	// AlertName is the name of the alert that, while firing, denies `PipelineRun`
+	// ingress.  Should be mutually exclusive with Query.
+	AlertName string `json:"alertName,omitempty"`
+
+	// Alerts selects firing alerts by their labels, as a more flexible
+	// alternative to AlertName.  Should be mutually exclusive with AlertName
+	// and Query.
+	Alerts *AlertSelectors `json:"alerts,omitempty"`
+
+	// Query is a PromQL expression evaluated as an instant query on every tick.  Its
+	// value is compared against SetThreshold and ResetThreshold to determine if
+	// `PipelineRun` ingress will be allowed.  Should be mutually exclusive with
+	// AlertName.
+	Query string `json:"query,omitempty"`
+
+	// SetThreshold is the value at or above which Query closes ingress.
+	SetThreshold Threshold `json:"setThreshold,omitempty"`
+
+	// ResetThreshold is the value below which Query reopens ingress.  Between
+	// ResetThreshold and SetThreshold the previous state is kept.
+	ResetThreshold Threshold `json:"resetThreshold,omitempty"`
 
 	// Config details the connection information to the prometheus server
 	Config config.HTTPClientConfig `json:"config"`
 }
 
-func GetConfig(l logr.Logger, path string) (*Config, error) {
+type EtcdMetricsConfig struct {
+	// Endpoints are the metrics URLs of each etcd member, such as
+	// https://10.0.0.1:2379/metrics.
+	Endpoints []string `json:"endpoints"`
+
+	// Config details the connection information, such as TLS client
+	// certificates, for the etcd members.
+	Config config.HTTPClientConfig `json:"config"`
+}
+
+// AlertMatch is how the selectors for an admission level are combined.
+type AlertMatch string
+
+const (
+	// AlertMatchAny applies a level when any of its selectors matches.
+	AlertMatchAny AlertMatch = "any"
+	// AlertMatchAll applies a level only when all of its selectors match.
+	AlertMatchAll AlertMatch = "all"
+)
+
+type AlertSelectors struct {
+	// Match is whether any or all of the selectors for a level have to match a
+	// firing alert for the level to apply.  Defaults to any.
+	Match AlertMatch `json:"match,omitempty"`
+
+	// Selectors pick the alerts to act on.
+	Selectors []AlertSelector `json:"selectors"`
+}
+
+type AlertSelector struct {
+	// Matchers are label matchers, such as `alertname="EtcdDBSizeHigh"` and
+	// `cluster="stone-prd-1"`, that a firing alert has to match all of.
+	Matchers []string `json:"matchers"`
+
+	// Level is the admission level while the selector matches, either closed
+	// or throttled.  Defaults to closed.
+	Level Level `json:"level,omitempty"`
+}
+
+type AlertmanagerConfig struct {
+	// Address of the Alertmanager, such as
+	// https://alertmanager-main.openshift-monitoring.svc:9094.
+	Address string `json:"address"`
+
+	// Matchers are label matchers, such as `cluster="stone-prd-1"`, that alerts
+	// must match as well as their name.
+	Matchers []string `json:"matchers,omitempty"`
+
+	// Config details the connection information to the Alertmanager.
+	Config config.HTTPClientConfig `json:"config"`
+}
+
+type EtcdStatusConfig struct {
+	// Endpoints are the client URLs of each etcd member, such as
+	// https://10.0.0.1:2379.
+	Endpoints []string `json:"endpoints"`
+
+	// TLS holds the client certificates used to talk to the etcd members.
+	// Plaintext is used when unset.
+	TLS *config.TLSConfig `json:"tls,omitempty"`
+
+	// Alarms close admission while any member reports one of them, such as
+	// NOSPACE, whatever the other signals say.
+	Alarms []string `json:"alarms,omitempty"`
+}
+
+type ThrottleConfig struct {
+	// AlertName is the name of the alert that, while firing, throttles ingress.
+	// Used when PrometheusConfig.AlertName is set.
+	AlertName string `json:"alertName,omitempty"`
+
+	// SetThreshold is the value of PrometheusConfig.Query at or above which
+	// ingress is throttled.
+	SetThreshold Threshold `json:"setThreshold,omitempty"`
+
+	// ResetThreshold is the value of PrometheusConfig.Query below which ingress
+	// stops being throttled.
+	ResetThreshold Threshold `json:"resetThreshold,omitempty"`
+
+	// Fraction is the fraction of `PipelineRuns`, between 0 and 1, admitted while
+	// throttled.  `PipelineRuns` are selected by a hash of their namespace and
+	// name.  Zero disables this limit.
+	Fraction float64 `json:"fraction,omitempty"`
+
+	// Budget is the number of `PipelineRuns` each webhook replica admits per
+	// Period while throttled.  Zero disables this limit.
+	Budget int `json:"budget,omitempty"`
+
+	// Period is the window Budget applies to.
+	Period Duration `json:"period,omitempty"`
+}
+
+type ResourceConfig struct {
+	// Group is the API group of the kind, empty for the core group.
+	Group string `json:"group,omitempty"`
+
+	// Version is the API version of the kind.
+	Version string `json:"version"`
+
+	// Kind is the kind of object to guard.
+	Kind string `json:"kind"`
+
+	// Path is where the validating webhook for the kind is served.  Defaults to
+	// the path controller-runtime generates, such as
+	// /validate-tekton-dev-v1-pipelinerun.
+	Path string `json:"path,omitempty"`
+
+	// Levels overrides the level enforced for the kind, keyed by the level the
+	// querier decided on.  For example, `throttled: closed` denies the kind
+	// outright while throttled.
+	Levels map[Level]Level `json:"levels,omitempty"`
+
+	// Enforcement is what happens to objects of the kind that would be
+	// denied.  Defaults to enforce.
+	Enforcement EnforcementMode `json:"enforcement,omitempty"`
+}
+
+// EnforcementMode is what the webhooks do with objects they would deny.
+type EnforcementMode string
+
+const (
+	// EnforcementEnforce denies them.
+	EnforcementEnforce EnforcementMode = "enforce"
+	// EnforcementWarn admits them with a warning saying they would have been
+	// denied.
+	EnforcementWarn EnforcementMode = "warn"
+	// EnforcementAudit admits them silently, only logging and counting that
+	// they would have been denied.
+	EnforcementAudit EnforcementMode = "audit"
+)
+
+// DefaultResource is the kind guarded if Resources is unset.
+var DefaultResource = ResourceConfig{Group: "tekton.dev", Version: "v1", Kind: "PipelineRun"}
+
+// GroupVersionKind is the kind of object guarded.
+func (r *ResourceConfig) GroupVersionKind() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: r.Group, Version: r.Version, Kind: r.Kind}
+}
+
+// validatePath is the path controller-runtime serves the validating webhook
+// for gvk on.
+func validatePath(gvk schema.GroupVersionKind) string {
+	return "/validate-" + strings.ReplaceAll(gvk.Group, ".", "-") + "-" + gvk.Version + "-" + strings.ToLower(gvk.Kind)
+}
+
+// DefaultDenialCode is the HTTP status code of denials if Denial.Code is unset.
+const DefaultDenialCode = http.StatusTooManyRequests
+
+// DefaultRetryAfter is how long denied clients are told to wait if
+// Denial.RetryAfter is unset.
+const DefaultRetryAfter = time.Minute
+
+type DenialConfig struct {
+	// Code is the HTTP status code of denials, between 400 and 599.  Defaults
+	// to 429, which clients that back off understand.
+	Code int32 `json:"code,omitempty"`
+
+	// RetryAfter is how long denied clients are told to wait before retrying.
+	// Defaults to 1m.
+	RetryAfter Duration `json:"retryAfter,omitempty"`
+
+	// StatusURL is a text/template for a link to more information, such as a
+	// status page, linked from denials.  It's executed with the denied
+	// object's Kind, Namespace and Name, and the state's Level, Signal and
+	// Reason.
+	StatusURL string `json:"statusURL,omitempty"`
+}
+
+type ExemptionConfig struct {
+	// Namespaces lists namespaces whose `PipelineRuns` are always admitted.
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// NamespaceSelector exempts `PipelineRuns` in namespaces matching its labels.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// ObjectSelector exempts `PipelineRuns` matching its labels.
+	ObjectSelector *metav1.LabelSelector `json:"objectSelector,omitempty"`
+
+	// Annotations exempts `PipelineRuns` carrying any of these annotations with
+	// the given value.
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type QueueConfig struct {
+	// Enabled turns on the mutating webhook that marks new `PipelineRuns` as
+	// pending while admission is closed, and the controller that releases them
+	// once it reopens.
+	Enabled bool `json:"enabled,omitempty"`
+
+	// BatchSize is how many queued `PipelineRuns` are released, oldest first,
+	// every WaitTime while admission is open.  Zero releases all of them at once.
+	BatchSize int `json:"batchSize,omitempty"`
+}
+
+type DampingConfig struct {
+	// MinOpen is the least time admission stays open before it can be
+	// throttled or closed.
+	MinOpen Duration `json:"minOpen,omitempty"`
+
+	// MinClosed is the least time admission stays closed before it can be
+	// reopened or throttled.
+	MinClosed Duration `json:"minClosed,omitempty"`
+
+	// Observations is how many checks in a row have to ask for a new level
+	// before it's applied.  Defaults to 1.
+	Observations int `json:"observations,omitempty"`
+}
+
+// RampMode is how the admitted fraction grows while ramping up.
+type RampMode string
+
+const (
+	// RampLinear grows the fraction by the same amount over each moment.
+	RampLinear RampMode = "linear"
+	// RampExponential grows the fraction by the same factor over each
+	// moment, so it starts slowly and catches up towards the end.
+	RampExponential RampMode = "exponential"
+)
+
+// DefaultRampInitialFraction is the fraction admitted as soon as admission
+// reopens if Ramp.InitialFraction is unset.
+const DefaultRampInitialFraction = 0.1
+
+type RampConfig struct {
+	// Duration is how long it takes to go from InitialFraction to admitting
+	// every `PipelineRun`.
+	Duration Duration `json:"duration"`
+
+	// Mode is how the fraction grows, either linear or exponential.  Defaults
+	// to linear.
+	Mode RampMode `json:"mode,omitempty"`
+
+	// InitialFraction is the fraction of `PipelineRuns`, between 0 and 1,
+	// admitted as soon as admission reopens.  Defaults to 0.1.
+	InitialFraction float64 `json:"initialFraction,omitempty"`
+}
+
+type QuotaConfig struct {
+	// Query returns etcd's quota, in bytes.  Defaults to
+	// max(etcd_server_quota_backend_bytes), or the metric itself for the
+	// etcdMetrics source.
+	Query string `json:"query,omitempty"`
+
+	// Fallback is the quota to use when Query fails or the source can't
+	// discover it, such as 8Gi.
+	Fallback *resource.Quantity `json:"fallback,omitempty"`
+}
+
+// QuotaMetric is the etcd metric holding its quota.
+const QuotaMetric = "etcd_server_quota_backend_bytes"
+
+type PredictionConfig struct {
+	// Query is a PromQL expression for the database size, such as
+	// max(etcd_mvcc_db_total_size_in_bytes).  It's run as a range query on the
+	// prometheus source.
+	Query string `json:"query"`
+
+	// Quota is the value of Query that admission is closed ahead of reaching.
+	// Defaults to 100% of etcd's quota.
+	Quota Threshold `json:"quota,omitempty"`
+
+	// Window is how far back the growth trend is fitted over.  Defaults to
+	// 10m.
+	Window Duration `json:"window,omitempty"`
+
+	// Step is the resolution of the range query.  Defaults to 30s.
+	Step Duration `json:"step,omitempty"`
+
+	// Horizon closes admission while the projected time until Quota is
+	// reached is shorter.
+	Horizon Duration `json:"horizon"`
+}
+
+type ReceiverConfig struct {
+	// BindAddress is the address the receiver listens on, such as :9444.  It's
+	// served over TLS with the same certificate as the webhooks.
+	BindAddress string `json:"bindAddress"`
+
+	// BearerTokenFile holds the token callers have to send as
+	// `Authorization: Bearer <token>`.  It's reread on every request, so it can
+	// be rotated.
+	BearerTokenFile string `json:"bearerTokenFile,omitempty"`
+
+	// ClientCAFile holds the CA certificates that callers' client certificates
+	// have to be signed by.
+	ClientCAFile string `json:"clientCAFile,omitempty"`
+}
+
+// StalePolicy is what the webhooks enforce once the state is stale.
+type StalePolicy string
+
+const (
+	// StalePolicyKeepLast keeps enforcing the last level that was written.
+	StalePolicyKeepLast StalePolicy = "keepLast"
+	// StalePolicyFailOpen admits every `PipelineRun`.
+	StalePolicyFailOpen StalePolicy = "failOpen"
+	// StalePolicyFailClosed denies every `PipelineRun`.
+	StalePolicyFailClosed StalePolicy = "failClosed"
+)
+
+// DefaultStateFileInterval is how often the state file is read if
+// StateFile.Interval is unset.
+const DefaultStateFileInterval = 5 * time.Second
+
+type StateFileConfig struct {
+	// Path is the directory the state ConfigMap is mounted on, or a file
+	// holding just the state record.
+	Path string `json:"path"`
+
+	// Interval is how often Path is read for changes.  Defaults to 5s.
+	Interval Duration `json:"interval,omitempty"`
+}
+
+type StalenessConfig struct {
+	// MaxAge is how long after the querier's last successful check the state is
+	// considered stale.  State that was never checked, such as a missing
+	// ConfigMap, is always stale.  Zero disables staleness detection.
+	MaxAge Duration `json:"maxAge,omitempty"`
+
+	// Policy is what to enforce once the state is stale.  Defaults to keepLast.
+	Policy StalePolicy `json:"policy,omitempty"`
+}
+
+// Role is which parts of etcd-shield a process runs.
+type Role string
+
+const (
+	// RoleAll runs both the querier and the webhooks.
+	RoleAll Role = "all"
+	// RoleQuerier only runs the querier, which updates the state.
+	RoleQuerier Role = "querier"
+	// RoleWebhook only runs the webhooks, which enforce the state.
+	RoleWebhook Role = "webhook"
+)
+
+// ParseRole converts a string to a Role, returning false if it isn't one we
+// know about.
+func ParseRole(s string) (Role, bool) {
+	switch role := Role(s); role {
+	case RoleAll, RoleQuerier, RoleWebhook:
+		return role, true
+	default:
+		return "", false
+	}
+}
+
+// RunsQuerier reports whether the role includes the querier.
+func (r Role) RunsQuerier() bool {
+	return r == RoleAll || r == RoleQuerier
+}
+
+// RunsWebhook reports whether the role includes the webhooks.
+func (r Role) RunsWebhook() bool {
+	return r == RoleAll || r == RoleWebhook
+}
+
+func GetConfig(l logr.Logger, path string, role Role) (*Config, error) {
 	contents, err := os.ReadFile(path)
 	if err != nil {
 		l.Error(err, "failed to read config", "path", path)
 		return nil, err
 	}
 
-	cfg := Config{}
-	err = yaml.Unmarshal(contents, &cfg)
+	cfg, err := ParseConfig(contents, role)
 	if err != nil {
 		l.Error(err, "failed to deserialize config", "path", path)
 		return nil, err
 	}
 
+	return cfg, nil
+}
+
+// ParseConfig deserializes a config from its YAML representation, then
+// defaults and validates it for role.
+func ParseConfig(contents []byte, role Role) (*Config, error) {
+	cfg := Config{}
+	err := yaml.Unmarshal(contents, &cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Default()
+	err = cfg.Validate(role).ToAggregate()
+	if err != nil {
+		return nil, err
+	}
+
 	return &cfg, nil
 }
+
+// DefaultWaitTime is how long we wait between checks if WaitTime is unset.
+const DefaultWaitTime = 15 * time.Second
+
+// DefaultThrottlePeriod is the window Throttle.Budget applies to if
+// Throttle.Period is unset.
+const DefaultThrottlePeriod = time.Minute
+
+// DefaultPredictionWindow is how far back growth is fitted over if
+// Prediction.Window is unset.
+const DefaultPredictionWindow = 10 * time.Minute
+
+// DefaultPredictionStep is the resolution of the growth range query if
+// Prediction.Step is unset.
+const DefaultPredictionStep = 30 * time.Second
+
+// Default fills in unset fields that have a sensible default.
+func (c *Config) Default() {
+	if c.Source == "" {
+		c.Source = SourcePrometheus
+	}
+	if len(c.Prometheus.Addresses) > 0 && c.Prometheus.Strategy == "" {
+		c.Prometheus.Strategy = StrategyFailover
+	}
+	if c.WaitTime.Duration == 0 {
+		c.WaitTime = NewDuration(DefaultWaitTime)
+	}
+	if c.Throttle != nil && c.Throttle.Budget > 0 && c.Throttle.Period.Duration == 0 {
+		c.Throttle.Period = NewDuration(DefaultThrottlePeriod)
+	}
+	if len(c.Resources) == 0 {
+		c.Resources = []ResourceConfig{DefaultResource}
+	}
+	for i := range c.Resources {
+		if c.Resources[i].Path == "" {
+			c.Resources[i].Path = validatePath(c.Resources[i].GroupVersionKind())
+		}
+		if c.Resources[i].Enforcement == "" {
+			c.Resources[i].Enforcement = EnforcementEnforce
+		}
+	}
+	if c.Denial.Code == 0 {
+		c.Denial.Code = DefaultDenialCode
+	}
+	if c.Denial.RetryAfter.Duration == 0 {
+		c.Denial.RetryAfter = NewDuration(DefaultRetryAfter)
+	}
+	if c.StateFile != nil && c.StateFile.Interval.Duration == 0 {
+		c.StateFile.Interval = NewDuration(DefaultStateFileInterval)
+	}
+	if c.Staleness.Policy == "" {
+		c.Staleness.Policy = StalePolicyKeepLast
+	}
+	if c.Damping.Observations == 0 {
+		c.Damping.Observations = 1
+	}
+	if c.Ramp != nil {
+		if c.Ramp.Mode == "" {
+			c.Ramp.Mode = RampLinear
+		}
+		if c.Ramp.InitialFraction == 0 {
+			c.Ramp.InitialFraction = DefaultRampInitialFraction
+		}
+	}
+	if c.Quota.Query == "" {
+		switch c.Source {
+		case SourcePrometheus:
+			c.Quota.Query = "max(" + QuotaMetric + ")"
+		case SourceEtcdMetrics:
+			c.Quota.Query = QuotaMetric
+		}
+	}
+	if c.Prediction != nil {
+		if c.Prediction.Quota.IsZero() {
+			c.Prediction.Quota = NewPercentThreshold(100)
+		}
+		if c.Prediction.Window.Duration == 0 {
+			c.Prediction.Window = NewDuration(DefaultPredictionWindow)
+		}
+		if c.Prediction.Step.Duration == 0 {
+			c.Prediction.Step = NewDuration(DefaultPredictionStep)
+		}
+	}
+	if alerts := c.Prometheus.Alerts; alerts != nil {
+		if alerts.Match == "" {
+			alerts.Match = AlertMatchAny
+		}
+		for i := range alerts.Selectors {
+			if alerts.Selectors[i].Level == "" {
+				alerts.Selectors[i].Level = LevelClosed
+			}
+		}
+	}
+}
+
+// Validate checks the config, returning every problem found.  Settings only
+// used by the querier aren't checked unless role runs it.
+func (c *Config) Validate(role Role) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if c.DestName == "" {
+		errs = append(errs, field.Required(field.NewPath("destName"), "name of the state ConfigMap"))
+	} else {
+		for _, msg := range validation.IsDNS1123Subdomain(c.DestName) {
+			errs = append(errs, field.Invalid(field.NewPath("destName"), c.DestName, msg))
+		}
+	}
+	if c.DestNamespace == "" {
+		errs = append(errs, field.Required(field.NewPath("destNamespace"), "namespace of the state ConfigMap"))
+	} else {
+		for _, msg := range validation.IsDNS1123Label(c.DestNamespace) {
+			errs = append(errs, field.Invalid(field.NewPath("destNamespace"), c.DestNamespace, msg))
+		}
+	}
+
+	if role.RunsQuerier() {
+		if c.WaitTime.Duration <= 0 {
+			errs = append(errs, field.Invalid(field.NewPath("waitTime"), c.WaitTime.String(), "must be positive"))
+		}
+		errs = append(errs, c.validateSource()...)
+		errs = append(errs, c.Damping.validate(field.NewPath("damping"))...)
+		if c.Ramp != nil {
+			errs = append(errs, c.Ramp.validate(field.NewPath("ramp"))...)
+		}
+		errs = append(errs, c.Quota.validate(field.NewPath("quota"), c.usesQuota())...)
+		if c.Prediction != nil {
+			errs = append(errs, c.Prediction.validate(field.NewPath("prediction"))...)
+			if c.Source != SourcePrometheus && c.Source != "" {
+				errs = append(errs, field.Forbidden(field.NewPath("prediction"), "needs the prometheus source for range queries"))
+			}
+		}
+	}
+	if c.Throttle != nil {
+		errs = append(errs, c.Throttle.validate(field.NewPath("throttle"), &c.Prometheus, role)...)
+	}
+	errs = append(errs, validateResources(field.NewPath("resources"), c.Resources)...)
+	errs = append(errs, c.Denial.validate(field.NewPath("denial"))...)
+	errs = append(errs, c.Exemptions.validate(field.NewPath("exemptions"))...)
+	errs = append(errs, c.Queue.validate(field.NewPath("queue"))...)
+	errs = append(errs, c.Staleness.validate(field.NewPath("staleness"))...)
+	if c.StateFile != nil && role.RunsWebhook() {
+		errs = append(errs, c.StateFile.validate(field.NewPath("stateFile"))...)
+	}
+	if c.Receiver != nil && role.RunsQuerier() {
+		errs = append(errs, c.Receiver.validate(field.NewPath("receiver"))...)
+	}
+
+	return errs
+}
+
+// validateSource checks the querier's signal source, and that the signal it
+// reads is one the source supports.
+func (c *Config) validateSource() field.ErrorList {
+	errs := field.ErrorList{}
+	path := field.NewPath("prometheus")
+
+	switch c.Source {
+	case SourcePrometheus, "":
+		if c.Prometheus.Address == "" && len(c.Prometheus.Addresses) == 0 {
+			errs = append(errs, field.Required(path.Child("address"), "address of the prometheus API"))
+		}
+		if err := c.Prometheus.Config.Validate(); err != nil {
+			errs = append(errs, field.Invalid(path.Child("config"), "", err.Error()))
+		}
+	case SourceEtcdMetrics:
+		if c.EtcdMetrics == nil {
+			errs = append(errs, field.Required(field.NewPath("etcdMetrics"), "required when source is etcdMetrics"))
+		} else {
+			errs = append(errs, c.EtcdMetrics.validate(field.NewPath("etcdMetrics"))...)
+		}
+		if c.Prometheus.AlertName != "" {
+			errs = append(errs, field.Forbidden(path.Child("alertName"), "alerts aren't supported by the etcdMetrics source"))
+		}
+		if c.Prometheus.Alerts != nil {
+			errs = append(errs, field.Forbidden(path.Child("alerts"), "alerts aren't supported by the etcdMetrics source"))
+		}
+		if c.Prometheus.Query != "" {
+			if _, err := parseMetricsQuery(c.Prometheus.Query); err != nil {
+				errs = append(errs, field.Invalid(path.Child("query"), c.Prometheus.Query, err.Error()))
+			}
+		}
+	case SourceEtcdStatus:
+		if c.EtcdStatus == nil {
+			errs = append(errs, field.Required(field.NewPath("etcdStatus"), "required when source is etcdStatus"))
+		}
+		if c.Prometheus.AlertName != "" {
+			if !isEtcdAlarm(c.Prometheus.AlertName) {
+				errs = append(errs, field.Invalid(path.Child("alertName"), c.Prometheus.AlertName,
+					"must be an etcd alarm when source is etcdStatus"))
+			}
+		}
+		if c.Prometheus.Query != "" && c.Prometheus.Query != StatusDBSize && c.Prometheus.Query != StatusDBSizeInUse {
+			errs = append(errs, field.NotSupported(path.Child("query"), c.Prometheus.Query,
+				[]string{StatusDBSize, StatusDBSizeInUse}))
+		}
+	case SourceAlertmanager:
+		if c.Alertmanager == nil {
+			errs = append(errs, field.Required(field.NewPath("alertmanager"), "required when source is alertmanager"))
+		} else {
+			errs = append(errs, c.Alertmanager.validate(field.NewPath("alertmanager"))...)
+		}
+		if c.Prometheus.Query != "" {
+			errs = append(errs, field.Forbidden(path.Child("query"), "queries aren't supported by the alertmanager source"))
+		}
+	default:
+		errs = append(errs, field.NotSupported(field.NewPath("source"), c.Source,
+			[]SourceType{SourcePrometheus, SourceEtcdMetrics, SourceEtcdStatus, SourceAlertmanager}))
+	}
+	if c.EtcdStatus != nil {
+		errs = append(errs, c.EtcdStatus.validate(field.NewPath("etcdStatus"))...)
+	}
+	if c.Prometheus.Alerts != nil {
+		errs = append(errs, c.Prometheus.Alerts.validate(path.Child("alerts"), c.Throttle)...)
+	}
+
+	errs = append(errs, c.Prometheus.validate(path)...)
+	return errs
+}
+
+func (p *PrometheusConfig) validate(path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if p.Address != "" {
+		if _, err := url.Parse(p.Address); err != nil {
+			errs = append(errs, field.Invalid(path.Child("address"), p.Address, err.Error()))
+		}
+		if len(p.Addresses) > 0 {
+			errs = append(errs, field.Forbidden(path.Child("addresses"), "may not be set together with address"))
+		}
+	}
+	for i, address := range p.Addresses {
+		if _, err := url.Parse(address); err != nil {
+			errs = append(errs, field.Invalid(path.Child("addresses").Index(i), address, err.Error()))
+		}
+	}
+	switch p.Strategy {
+	case StrategyFailover, StrategyQuorum, "":
+	default:
+		errs = append(errs, field.NotSupported(path.Child("strategy"), p.Strategy,
+			[]EndpointStrategy{StrategyFailover, StrategyQuorum}))
+	}
+
+	switch {
+	case p.AlertName == "" && p.Query == "" && p.Alerts == nil:
+		errs = append(errs, field.Required(path, "one of alertName, alerts or query must be set"))
+	case p.AlertName != "" && p.Query != "":
+		errs = append(errs, field.Forbidden(path.Child("query"), "may not be set together with alertName"))
+	case p.Alerts != nil && p.AlertName != "":
+		errs = append(errs, field.Forbidden(path.Child("alerts"), "may not be set together with alertName"))
+	case p.Alerts != nil && p.Query != "":
+		errs = append(errs, field.Forbidden(path.Child("alerts"), "may not be set together with query"))
+	case p.Query != "" && thresholdAbove(p.ResetThreshold, p.SetThreshold):
+		errs = append(errs, field.Invalid(path.Child("resetThreshold"), p.ResetThreshold.String(),
+			"must not be greater than setThreshold"))
+	}
+	if p.Query != "" && p.AlertName == "" && p.Alerts == nil {
+		errs = append(errs, requireThresholds(path, p.SetThreshold, p.ResetThreshold)...)
+	}
+	errs = append(errs, validateThreshold(path.Child("setThreshold"), p.SetThreshold)...)
+	errs = append(errs, validateThreshold(path.Child("resetThreshold"), p.ResetThreshold)...)
+
+	return errs
+}
+
+// requireThresholds checks that both thresholds of a query are set, since a
+// zero threshold would latch on every value.
+func requireThresholds(path *field.Path, set, reset Threshold) field.ErrorList {
+	errs := field.ErrorList{}
+	if set.IsZero() {
+		errs = append(errs, field.Required(path.Child("setThreshold"), "required when a query is set"))
+	}
+	if reset.IsZero() {
+		errs = append(errs, field.Required(path.Child("resetThreshold"), "required when a query is set"))
+	}
+	return errs
+}
+
+// validateThreshold checks that percentages are within 0 and 100.
+func validateThreshold(path *field.Path, t Threshold) field.ErrorList {
+	if t.Percent && (t.Value < 0 || t.Value > 100) {
+		return field.ErrorList{field.Invalid(path, t.String(), "must be between 0% and 100%")}
+	}
+	return nil
+}
+
+// thresholdAbove indicates whether a is greater than b.  Thresholds of
+// different kinds can only be compared once the quota is known, so they never
+// are here.
+func thresholdAbove(a, b Threshold) bool {
+	return a.Percent == b.Percent && a.Value > b.Value
+}
+
+// usesQuota indicates whether any threshold is relative to etcd's quota.
+func (c *Config) usesQuota() bool {
+	return c.levelsUseQuota() || (c.Prediction != nil && c.Prediction.Quota.Percent)
+}
+
+// levelsUseQuota indicates whether any of the thresholds the level is
+// evaluated from is relative to etcd's quota, as opposed to only the
+// prediction's.
+func (c *Config) levelsUseQuota() bool {
+	thresholds := []Threshold{c.Prometheus.SetThreshold, c.Prometheus.ResetThreshold}
+	if c.Throttle != nil {
+		thresholds = append(thresholds, c.Throttle.SetThreshold, c.Throttle.ResetThreshold)
+	}
+	for _, t := range thresholds {
+		if t.Percent {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *DampingConfig) validate(path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if d.MinOpen.Duration < 0 {
+		errs = append(errs, field.Invalid(path.Child("minOpen"), d.MinOpen.String(), "must not be negative"))
+	}
+	if d.MinClosed.Duration < 0 {
+		errs = append(errs, field.Invalid(path.Child("minClosed"), d.MinClosed.String(), "must not be negative"))
+	}
+	if d.Observations < 0 {
+		errs = append(errs, field.Invalid(path.Child("observations"), d.Observations, "must not be negative"))
+	}
+
+	return errs
+}
+
+func (r *RampConfig) validate(path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if r.Duration.Duration <= 0 {
+		errs = append(errs, field.Invalid(path.Child("duration"), r.Duration.String(), "must be positive"))
+	}
+	switch r.Mode {
+	case RampLinear, RampExponential:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("mode"), r.Mode, []RampMode{RampLinear, RampExponential}))
+	}
+	if r.InitialFraction <= 0 || r.InitialFraction > 1 {
+		errs = append(errs, field.Invalid(path.Child("initialFraction"), r.InitialFraction, "must be above 0 and at most 1"))
+	}
+
+	return errs
+}
+
+func (q *QuotaConfig) validate(path *field.Path, required bool) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if q.Fallback != nil && q.Fallback.Sign() <= 0 {
+		errs = append(errs, field.Invalid(path.Child("fallback"), q.Fallback.String(), "must be positive"))
+	}
+	if required && q.Query == "" && q.Fallback == nil {
+		errs = append(errs, field.Required(path.Child("fallback"),
+			"percentage thresholds need a quota, and the source can't discover it"))
+	}
+
+	return errs
+}
+
+func (a *AlertSelectors) validate(path *field.Path, throttle *ThrottleConfig) field.ErrorList {
+	errs := field.ErrorList{}
+
+	switch a.Match {
+	case AlertMatchAny, AlertMatchAll, "":
+	default:
+		errs = append(errs, field.NotSupported(path.Child("match"), a.Match, []AlertMatch{AlertMatchAny, AlertMatchAll}))
+	}
+	if len(a.Selectors) == 0 {
+		errs = append(errs, field.Required(path.Child("selectors"), "at least one selector"))
+	}
+	for i, selector := range a.Selectors {
+		selectorPath := path.Child("selectors").Index(i)
+		if len(selector.Matchers) == 0 {
+			errs = append(errs, field.Required(selectorPath.Child("matchers"), "at least one label matcher"))
+		}
+		for j, matcher := range selector.Matchers {
+			if _, err := ParseMatcher(matcher); err != nil {
+				errs = append(errs, field.Invalid(selectorPath.Child("matchers").Index(j), matcher, err.Error()))
+			}
+		}
+		switch selector.Level {
+		case LevelClosed, "":
+		case LevelThrottled:
+			if throttle == nil {
+				errs = append(errs, field.Invalid(selectorPath.Child("level"), selector.Level,
+					"throttle must be configured to throttle admission"))
+			}
+		default:
+			errs = append(errs, field.NotSupported(selectorPath.Child("level"), selector.Level,
+				[]Level{LevelClosed, LevelThrottled}))
+		}
+	}
+
+	return errs
+}
+
+func (a *AlertmanagerConfig) validate(path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if a.Address == "" {
+		errs = append(errs, field.Required(path.Child("address"), "address of the alertmanager API"))
+	} else if _, err := url.Parse(a.Address); err != nil {
+		errs = append(errs, field.Invalid(path.Child("address"), a.Address, err.Error()))
+	}
+	for i, matcher := range a.Matchers {
+		if _, err := ParseMatcher(matcher); err != nil {
+			errs = append(errs, field.Invalid(path.Child("matchers").Index(i), matcher, err.Error()))
+		}
+	}
+	if err := a.Config.Validate(); err != nil {
+		errs = append(errs, field.Invalid(path.Child("config"), "", err.Error()))
+	}
+
+	return errs
+}
+
+func (e *EtcdStatusConfig) validate(path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if len(e.Endpoints) == 0 {
+		errs = append(errs, field.Required(path.Child("endpoints"), "client URL of at least one etcd member"))
+	}
+	for i, endpoint := range e.Endpoints {
+		if _, err := url.Parse(endpoint); err != nil {
+			errs = append(errs, field.Invalid(path.Child("endpoints").Index(i), endpoint, err.Error()))
+		}
+	}
+	if e.TLS != nil {
+		if err := e.TLS.Validate(); err != nil {
+			errs = append(errs, field.Invalid(path.Child("tls"), "", err.Error()))
+		}
+	}
+	for i, alarm := range e.Alarms {
+		if !isEtcdAlarm(alarm) {
+			errs = append(errs, field.Invalid(path.Child("alarms").Index(i), alarm, "must be an etcd alarm, such as NOSPACE"))
+		}
+	}
+
+	return errs
+}
+
+func (e *EtcdMetricsConfig) validate(path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if len(e.Endpoints) == 0 {
+		errs = append(errs, field.Required(path.Child("endpoints"), "metrics URL of at least one etcd member"))
+	}
+	for i, endpoint := range e.Endpoints {
+		if _, err := url.Parse(endpoint); err != nil {
+			errs = append(errs, field.Invalid(path.Child("endpoints").Index(i), endpoint, err.Error()))
+		}
+	}
+	if err := e.Config.Validate(); err != nil {
+		errs = append(errs, field.Invalid(path.Child("config"), "", err.Error()))
+	}
+
+	return errs
+}
+
+func (t *ThrottleConfig) validate(path *field.Path, prometheus *PrometheusConfig, role Role) field.ErrorList {
+	errs := field.ErrorList{}
+
+	// the throttle's signal is only used by the querier
+	if role.RunsQuerier() {
+		errs = append(errs, t.validateSignal(path, prometheus)...)
+	}
+
+	if t.Fraction < 0 || t.Fraction > 1 {
+		errs = append(errs, field.Invalid(path.Child("fraction"), t.Fraction, "must be between 0 and 1"))
+	}
+	if t.Budget < 0 {
+		errs = append(errs, field.Invalid(path.Child("budget"), t.Budget, "must not be negative"))
+	}
+	if t.Fraction == 0 && t.Budget == 0 {
+		errs = append(errs, field.Required(path, "at least one of fraction or budget must be set"))
+	}
+	if t.Period.Duration < 0 {
+		errs = append(errs, field.Invalid(path.Child("period"), t.Period.String(), "must not be negative"))
+	}
+
+	return errs
+}
+
+func (t *ThrottleConfig) validateSignal(path *field.Path, prometheus *PrometheusConfig) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if prometheus.Alerts != nil {
+		if t.AlertName != "" {
+			errs = append(errs, field.Forbidden(path.Child("alertName"),
+				"may not be set together with prometheus.alerts, use a selector with level throttled instead"))
+		}
+	} else if prometheus.Query == "" {
+		if t.AlertName == "" {
+			errs = append(errs, field.Required(path.Child("alertName"), "required when prometheus.alertName is set"))
+		}
+	} else {
+		if t.AlertName != "" {
+			errs = append(errs, field.Forbidden(path.Child("alertName"), "may not be set together with prometheus.query"))
+		}
+		if prometheus.AlertName == "" {
+			// otherwise prometheus.query is already rejected
+			errs = append(errs, requireThresholds(path, t.SetThreshold, t.ResetThreshold)...)
+		}
+		if thresholdAbove(t.ResetThreshold, t.SetThreshold) {
+			errs = append(errs, field.Invalid(path.Child("resetThreshold"), t.ResetThreshold.String(),
+				"must not be greater than setThreshold"))
+		}
+		if thresholdAbove(t.SetThreshold, prometheus.SetThreshold) {
+			errs = append(errs, field.Invalid(path.Child("setThreshold"), t.SetThreshold.String(),
+				"must not be greater than prometheus.setThreshold"))
+		}
+		errs = append(errs, validateThreshold(path.Child("setThreshold"), t.SetThreshold)...)
+		errs = append(errs, validateThreshold(path.Child("resetThreshold"), t.ResetThreshold)...)
+	}
+
+	return errs
+}
+
+func validateResources(path *field.Path, resources []ResourceConfig) field.ErrorList {
+	errs := field.ErrorList{}
+
+	kinds := map[schema.GroupVersionKind]bool{}
+	paths := map[string]bool{}
+	for i, resource := range resources {
+		path := path.Index(i)
+		if resource.Version == "" {
+			errs = append(errs, field.Required(path.Child("version"), "API version of the kind"))
+		}
+		if resource.Kind == "" {
+			errs = append(errs, field.Required(path.Child("kind"), "kind of object to guard"))
+		}
+		if gvk := resource.GroupVersionKind(); kinds[gvk] {
+			errs = append(errs, field.Duplicate(path, gvk.String()))
+		} else {
+			kinds[gvk] = true
+		}
+		if !strings.HasPrefix(resource.Path, "/") {
+			errs = append(errs, field.Invalid(path.Child("path"), resource.Path, "must start with /"))
+		} else if paths[resource.Path] {
+			errs = append(errs, field.Duplicate(path.Child("path"), resource.Path))
+		} else {
+			paths[resource.Path] = true
+		}
+		switch resource.Enforcement {
+		case EnforcementEnforce, EnforcementWarn, EnforcementAudit:
+		default:
+			errs = append(errs, field.NotSupported(path.Child("enforcement"), resource.Enforcement,
+				[]EnforcementMode{EnforcementEnforce, EnforcementWarn, EnforcementAudit}))
+		}
+		for from, to := range resource.Levels {
+			if _, ok := ParseLevel(string(from)); !ok {
+				errs = append(errs, field.NotSupported(path.Child("levels"), from, []Level{LevelOpen, LevelThrottled, LevelClosed}))
+			}
+			if _, ok := ParseLevel(string(to)); !ok {
+				errs = append(errs, field.NotSupported(path.Child("levels").Key(string(from)), to, []Level{LevelOpen, LevelThrottled, LevelClosed}))
+			}
+		}
+	}
+
+	return errs
+}
+
+func (d *DenialConfig) validate(path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if d.Code != 0 && (d.Code < 400 || d.Code > 599) {
+		errs = append(errs, field.Invalid(path.Child("code"), d.Code, "must be an HTTP error code between 400 and 599"))
+	}
+	if d.RetryAfter.Duration < 0 {
+		errs = append(errs, field.Invalid(path.Child("retryAfter"), d.RetryAfter.String(), "must not be negative"))
+	}
+	if _, err := parseStatusURL(d.StatusURL); err != nil {
+		errs = append(errs, field.Invalid(path.Child("statusURL"), d.StatusURL, err.Error()))
+	}
+
+	return errs
+}
+
+func (e *ExemptionConfig) validate(path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+
+	for i, namespace := range e.Namespaces {
+		for _, msg := range validation.IsDNS1123Label(namespace) {
+			errs = append(errs, field.Invalid(path.Child("namespaces").Index(i), namespace, msg))
+		}
+	}
+
+	opts := metav1validation.LabelSelectorValidationOptions{}
+	errs = append(errs, metav1validation.ValidateLabelSelector(e.NamespaceSelector, opts, path.Child("namespaceSelector"))...)
+	errs = append(errs, metav1validation.ValidateLabelSelector(e.ObjectSelector, opts, path.Child("objectSelector"))...)
+
+	return errs
+}
+
+func (q *QueueConfig) validate(path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if q.BatchSize < 0 {
+		errs = append(errs, field.Invalid(path.Child("batchSize"), q.BatchSize, "must not be negative"))
+	}
+
+	return errs
+}
+
+func (p *PredictionConfig) validate(path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if p.Query == "" {
+		errs = append(errs, field.Required(path.Child("query"), "PromQL expression for the database size"))
+	}
+	errs = append(errs, validateThreshold(path.Child("quota"), p.Quota)...)
+	if p.Quota.Value <= 0 {
+		errs = append(errs, field.Invalid(path.Child("quota"), p.Quota.String(), "must be positive"))
+	}
+	if p.Horizon.Duration <= 0 {
+		errs = append(errs, field.Invalid(path.Child("horizon"), p.Horizon.String(), "must be positive"))
+	}
+	if p.Step.Duration <= 0 {
+		errs = append(errs, field.Invalid(path.Child("step"), p.Step.String(), "must be positive"))
+	} else if p.Window.Duration < 2*p.Step.Duration {
+		errs = append(errs, field.Invalid(path.Child("window"), p.Window.String(), "must cover at least two steps"))
+	}
+
+	return errs
+}
+
+func (r *ReceiverConfig) validate(path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if r.BindAddress == "" {
+		errs = append(errs, field.Required(path.Child("bindAddress"), "address to listen on"))
+	}
+	if r.BearerTokenFile == "" && r.ClientCAFile == "" {
+		errs = append(errs, field.Required(path, "at least one of bearerTokenFile or clientCAFile must be set"))
+	}
+
+	return errs
+}
+
+func (s *StateFileConfig) validate(path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if s.Path == "" {
+		errs = append(errs, field.Required(path.Child("path"), "where the state ConfigMap is mounted"))
+	}
+	if s.Interval.Duration <= 0 {
+		errs = append(errs, field.Invalid(path.Child("interval"), s.Interval.String(), "must be positive"))
+	}
+
+	return errs
+}
+
+func (s *StalenessConfig) validate(path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if s.MaxAge.Duration < 0 {
+		errs = append(errs, field.Invalid(path.Child("maxAge"), s.MaxAge.String(), "must not be negative"))
+	}
+	switch s.Policy {
+	case StalePolicyKeepLast, StalePolicyFailOpen, StalePolicyFailClosed:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("policy"), s.Policy,
+			[]StalePolicy{StalePolicyKeepLast, StalePolicyFailOpen, StalePolicyFailClosed}))
+	}
+
+	return errs
+}
@@ -54,4 +54,215 @@ var _ = Describe("Pkg/Config", func() {
 		Expect(config.Prometheus.Address).To(Equal("prometheus.prometheus.svc:8080"))
 		Expect(config.WaitTime).To(Equal(etcd_shield.NewDuration(15 * time.Second)))
 	})
+
+	It("Should default unset fields", func() {
+		config, err := etcd_shield.ParseConfig([]byte(`
+destName: etcd-shield-state
+destNamespace: etcd-shield
+prometheus:
+  address: http://prometheus:9090
+  alertName: foo
+throttle:
+  alertName: bar
+  budget: 5
+`), etcd_shield.RoleAll)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.WaitTime).To(Equal(etcd_shield.NewDuration(etcd_shield.DefaultWaitTime)))
+		Expect(config.Throttle.Period).To(Equal(etcd_shield.NewDuration(etcd_shield.DefaultThrottlePeriod)))
+		Expect(config.Staleness.Policy).To(Equal(etcd_shield.StalePolicyKeepLast))
+		Expect(config.Resources).To(HaveExactElements(etcd_shield.ResourceConfig{
+			Group:       "tekton.dev",
+			Version:     "v1",
+			Kind:        "PipelineRun",
+			Path:        "/validate-tekton-dev-v1-pipelinerun",
+			Enforcement: etcd_shield.EnforcementEnforce,
+		}))
+	})
+
+	It("Should validate the resources guarded and their denials", func() {
+		_, err := etcd_shield.ParseConfig([]byte(`
+destName: etcd-shield-state
+destNamespace: etcd-shield
+prometheus:
+  address: http://prometheus:9090
+  alertName: foo
+resources:
+- group: tekton.dev
+  version: v1
+  kind: TaskRun
+  levels:
+    throttled: closed
+- group: tekton.dev
+  version: v1
+  kind: TaskRun
+  path: /validate-taskruns
+- version: v1
+  kind: Pod
+  path: validate-pods
+  levels:
+    paused: open
+  enforcement: dryRun
+denial:
+  code: 200
+  statusURL: https://status.example.com/{{.Namespace
+`), etcd_shield.RoleAll)
+		Expect(err).To(MatchError(ContainSubstring("resources[1]: Duplicate value")))
+		Expect(err).To(MatchError(ContainSubstring("resources[2].path")))
+		Expect(err).To(MatchError(ContainSubstring("resources[2].levels")))
+		Expect(err).To(MatchError(ContainSubstring("resources[2].enforcement")))
+		Expect(err).To(MatchError(ContainSubstring("denial.code")))
+		Expect(err).To(MatchError(ContainSubstring("denial.statusURL")))
+		Expect(err).NotTo(MatchError(ContainSubstring("resources[0]")))
+	})
+
+	It("Should report every invalid field with its path", func() {
+		config := etcd_shield.Config{
+			Prometheus: etcd_shield.PrometheusConfig{
+				AlertName: "foo",
+				Query:     "bar",
+			},
+			WaitTime: etcd_shield.NewDuration(-time.Second),
+			Throttle: &etcd_shield.ThrottleConfig{Fraction: 1.5},
+			Exemptions: etcd_shield.ExemptionConfig{
+				Namespaces: []string{"release", "Not A Namespace"},
+			},
+			Queue:     etcd_shield.QueueConfig{BatchSize: -1},
+			Staleness: etcd_shield.StalenessConfig{Policy: "sometimes"},
+		}
+
+		fields := []string{}
+		for _, err := range config.Validate(etcd_shield.RoleAll) {
+			fields = append(fields, err.Field)
+		}
+		Expect(fields).To(ConsistOf(
+			"destName",
+			"destNamespace",
+			"waitTime",
+			"prometheus.address",
+			"prometheus.query",
+			"throttle.fraction",
+			"exemptions.namespaces[1]",
+			"queue.batchSize",
+			"staleness.policy",
+		))
+	})
+
+	It("Should require thresholds for a query", func() {
+		_, err := etcd_shield.ParseConfig([]byte(`
+destName: etcd-shield-state
+destNamespace: etcd-shield
+prometheus:
+  address: http://prometheus:9090
+  query: max(etcd_mvcc_db_total_size_in_bytes)
+throttle:
+  fraction: 0.5
+`), etcd_shield.RoleAll)
+		Expect(err).To(MatchError(ContainSubstring("prometheus.setThreshold: Required value")))
+		Expect(err).To(MatchError(ContainSubstring("prometheus.resetThreshold: Required value")))
+		Expect(err).To(MatchError(ContainSubstring("throttle.setThreshold: Required value")))
+		Expect(err).To(MatchError(ContainSubstring("throttle.resetThreshold: Required value")))
+	})
+
+	It("Should accept the shipped config", func() {
+		_, err := etcd_shield.GetConfig(GinkgoLogr, "../config/config.yaml", etcd_shield.RoleAll)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should only require prometheus settings for the querier", func() {
+		contents := []byte(`
+destName: etcd-shield-state
+destNamespace: etcd-shield
+throttle:
+  fraction: 0.5
+`)
+		_, err := etcd_shield.ParseConfig(contents, etcd_shield.RoleWebhook)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = etcd_shield.ParseConfig(contents, etcd_shield.RoleQuerier)
+		Expect(err).To(MatchError(ContainSubstring("prometheus.address")))
+		Expect(err).To(MatchError(ContainSubstring("throttle.alertName")))
+	})
+
+	It("Should validate alert selectors", func() {
+		_, err := etcd_shield.ParseConfig([]byte(`
+destName: etcd-shield-state
+destNamespace: etcd-shield
+prometheus:
+  address: http://prometheus:9090
+  alerts:
+    match: most
+    selectors:
+    - matchers: ['alertname="EtcdDBSizeHigh"', 'cluster=~"("']
+    - matchers: ['alertname="EtcdDBSizeWarning"']
+      level: throttled
+`), etcd_shield.RoleAll)
+		Expect(err).To(MatchError(ContainSubstring("prometheus.alerts.match")))
+		Expect(err).To(MatchError(ContainSubstring("prometheus.alerts.selectors[0].matchers[1]")))
+		Expect(err).To(MatchError(ContainSubstring("prometheus.alerts.selectors[1].level")))
+	})
+
+	It("Should accept thresholds as numbers, quantities or percentages", func() {
+		config, err := etcd_shield.ParseConfig([]byte(`
+destName: etcd-shield-state
+destNamespace: etcd-shield
+prometheus:
+  address: http://prometheus:9090
+  query: max(etcd_mvcc_db_total_size_in_bytes)
+  setThreshold: 95%
+  resetThreshold: 7Gi
+throttle:
+  fraction: 0.5
+  setThreshold: 1e9
+  resetThreshold: 500M
+`), etcd_shield.RoleAll)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Prometheus.SetThreshold).To(Equal(etcd_shield.NewPercentThreshold(95)))
+		Expect(config.Prometheus.ResetThreshold).To(Equal(etcd_shield.NewThreshold(7 * 1024 * 1024 * 1024)))
+		Expect(config.Throttle.SetThreshold).To(Equal(etcd_shield.NewThreshold(1e9)))
+		Expect(config.Throttle.ResetThreshold).To(Equal(etcd_shield.NewThreshold(5e8)))
+		Expect(config.Quota.Query).To(Equal("max(etcd_server_quota_backend_bytes)"))
+		Expect(config.Prometheus.SetThreshold.Resolve(1000)).To(Equal(950.0))
+
+		out, err := yaml.Marshal(config.Prometheus.SetThreshold)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(out)).To(Equal("95%\n"))
+	})
+
+	It("Should need a quota for percentages when the source can't discover it", func() {
+		_, err := etcd_shield.ParseConfig([]byte(`
+destName: etcd-shield-state
+destNamespace: etcd-shield
+source: etcdStatus
+etcdStatus:
+  endpoints: [https://10.0.0.1:2379]
+prometheus:
+  query: dbSize
+  setThreshold: 150%
+  resetThreshold: 80%
+`), etcd_shield.RoleAll)
+		Expect(err).To(MatchError(ContainSubstring("quota.fallback")))
+		Expect(err).To(MatchError(ContainSubstring("prometheus.setThreshold")))
+	})
+
+	It("Should validate damping and ramping", func() {
+		_, err := etcd_shield.ParseConfig([]byte(`
+destName: etcd-shield-state
+destNamespace: etcd-shield
+prometheus:
+  address: http://prometheus:9090
+  alertName: EtcdDBSizeHigh
+damping:
+  minClosed: -1m
+  observations: -2
+ramp:
+  duration: 0s
+  mode: quadratic
+  initialFraction: 1.5
+`), etcd_shield.RoleAll)
+		Expect(err).To(MatchError(ContainSubstring("damping.minClosed")))
+		Expect(err).To(MatchError(ContainSubstring("damping.observations")))
+		Expect(err).To(MatchError(ContainSubstring("ramp.duration")))
+		Expect(err).To(MatchError(ContainSubstring("ramp.mode")))
+		Expect(err).To(MatchError(ContainSubstring("ramp.initialFraction")))
+	})
 })
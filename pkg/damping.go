@@ -0,0 +1,63 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield
+
+import (
+	"fmt"
+	"time"
+)
+
+// damp holds record at the current level while the change it asks for hasn't
+// been seen for enough checks in a row, or the current level hasn't lasted
+// its minimum time.  The held back level is kept in record, so the count
+// carries over to the next check.  Triggered checks, made between ticks, can
+// start counting a change but don't add to the count, so a burst of alert
+// notifications can't stand in for observations spread over time.
+func damp(cfg DampingConfig, current, record *StateRecord, now time.Time, triggered bool) {
+	if record.Level == current.Level || current.LastTransitionTime.IsZero() {
+		// nothing to hold back, or nothing to hold it at
+		return
+	}
+
+	count := 0
+	if current.PendingLevel == record.Level {
+		count = current.PendingCount
+	}
+	if !triggered || count == 0 {
+		count++
+	}
+
+	var held string
+	var dwell time.Duration
+	switch current.Level {
+	case LevelOpen:
+		dwell = cfg.MinOpen.Duration
+	case LevelClosed:
+		dwell = cfg.MinClosed.Duration
+	}
+	if since := now.Sub(current.LastTransitionTime.Time); since < dwell {
+		held = fmt.Sprintf("the minimum %s time of %s has %s left", current.Level, dwell, (dwell - since).Round(time.Second))
+	} else if count < cfg.Observations {
+		held = fmt.Sprintf("%s was asked for %d of %d checks in a row", record.Level, count, cfg.Observations)
+	}
+	if held == "" {
+		return
+	}
+
+	record.PendingLevel = record.Level
+	record.PendingCount = count
+	record.Reason = fmt.Sprintf("staying %s since %s (%s)", current.Level, held, record.Reason)
+	record.Level = current.Level
+}
@@ -0,0 +1,180 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Causes attached to denials, so clients can tell why they were denied
+// without parsing the message.
+const (
+	// CauseLevel is the admission level enforced.
+	CauseLevel metav1.CauseType = "EtcdShieldLevel"
+	// CauseSignal is the alert or query that decided the level.
+	CauseSignal metav1.CauseType = "EtcdShieldSignal"
+	// CauseValue is a value observed while deciding the level, named by the
+	// cause's field.
+	CauseValue metav1.CauseType = "EtcdShieldValue"
+	// CauseSince is when the level was decided on, in RFC 3339.
+	CauseSince metav1.CauseType = "EtcdShieldSince"
+	// CauseStatusURL links to more information.
+	CauseStatusURL metav1.CauseType = "EtcdShieldStatusURL"
+)
+
+// statusURLData is what DenialConfig.StatusURL is executed with.
+type statusURLData struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Level     Level
+	Signal    string
+	Reason    string
+}
+
+// parseStatusURL parses the DenialConfig.StatusURL template, returning nil if
+// there isn't one.
+func parseStatusURL(statusURL string) (*template.Template, error) {
+	if statusURL == "" {
+		return nil, nil
+	}
+	return template.New("statusURL").Option("missingkey=error").Parse(statusURL)
+}
+
+// deny builds the error denying obj as decided by d, or nil if d admits it.
+// Denials are a metav1.Status explaining the level enforced and the state
+// record it's based on, so clients can show why, and back off for the
+// suggested time.
+func (s *webhookSettings) deny(ctx context.Context, resource *ResourceConfig, d decision, obj metav1.Object) error {
+	kind := kindOf(resource)
+	var message string
+	switch d.outcome {
+	case OutcomeThrottled:
+		message = kind + " admission currently throttled"
+	case OutcomeRamping:
+		message = kind + " admission currently ramping up after reopening"
+	case OutcomeDenied:
+		message = kind + " admission currently not allowed"
+	default:
+		return nil
+	}
+
+	record := d.record
+	reason, since := record.Reason, record.LastTransitionTime
+	if d.stale != "" {
+		// the record's level isn't enforced, so neither its reason nor its
+		// transition time apply
+		reason, since = d.stale, metav1.Time{}
+	}
+	if d.overridden != "" {
+		override := fmt.Sprintf("admission is %s, which is %s for %s", d.overridden, d.level, kind)
+		if reason != "" {
+			reason += "; " + override
+		} else {
+			reason = override
+		}
+	}
+
+	causes := []metav1.StatusCause{{Type: CauseLevel, Message: string(d.level)}}
+	if reason != "" {
+		message += ": " + reason
+	}
+	if record.Signal != "" {
+		causes = append(causes, metav1.StatusCause{Type: CauseSignal, Message: record.Signal})
+	}
+	names := make([]string, 0, len(record.Values))
+	for name := range record.Values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		causes = append(causes, metav1.StatusCause{
+			Type:    CauseValue,
+			Field:   name,
+			Message: strconv.FormatFloat(record.Values[name], 'g', -1, 64),
+		})
+	}
+	if !since.IsZero() {
+		since := since.UTC().Format(time.RFC3339)
+		message += fmt.Sprintf(", %s since %s", d.level, since)
+		causes = append(causes, metav1.StatusCause{Type: CauseSince, Message: since})
+	}
+	if s.statusURL != nil {
+		link := strings.Builder{}
+		err := s.statusURL.Execute(&link, statusURLData{
+			Kind:      kind,
+			Namespace: obj.GetNamespace(),
+			Name:      objectName(obj),
+			Level:     d.level,
+			Signal:    record.Signal,
+			Reason:    reason,
+		})
+		if err != nil {
+			logr.FromContextOrDiscard(ctx).Error(err, "failed to build the status URL")
+		} else {
+			message += "; see " + link.String()
+			causes = append(causes, metav1.StatusCause{Type: CauseStatusURL, Message: link.String()})
+		}
+	}
+
+	group := pipelineRunKind.Group
+	if resource != nil {
+		group = resource.Group
+	}
+	code := s.denial.Code
+	if code == 0 {
+		code = DefaultDenialCode
+	}
+	retryAfter := math.Ceil(s.denial.RetryAfter.Seconds())
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    code,
+		Reason:  statusReason(code),
+		Message: message,
+		Details: &metav1.StatusDetails{
+			Name:              obj.GetName(),
+			Group:             group,
+			Kind:              kind,
+			RetryAfterSeconds: int32(retryAfter),
+			Causes:            causes,
+		},
+	}}
+}
+
+// statusReason is the reason matching an HTTP status code.
+func statusReason(code int32) metav1.StatusReason {
+	switch code {
+	case http.StatusTooManyRequests:
+		return metav1.StatusReasonTooManyRequests
+	case http.StatusServiceUnavailable:
+		return metav1.StatusReasonServiceUnavailable
+	case http.StatusForbidden:
+		return metav1.StatusReasonForbidden
+	default:
+		return metav1.StatusReasonUnknown
+	}
+}
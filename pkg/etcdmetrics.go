@@ -0,0 +1,199 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/config"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+)
+
+// EtcdMetrics is a PromQuery that scrapes the metrics endpoints of etcd
+// members directly, so it keeps working while the monitoring stack is down.
+//
+// Queries name a single metric, such as etcd_mvcc_db_total_size_in_bytes, or
+// divide one metric by another, such as
+// `etcd_mvcc_db_total_size_in_bytes / etcd_server_quota_backend_bytes`.  The
+// query is evaluated for each member and the largest value is used.
+type EtcdMetrics struct {
+	endpoints []string
+	client    *http.Client
+}
+
+var _ PromQuery = &EtcdMetrics{}
+
+func NewEtcdMetrics(endpoints []string, cfg config.HTTPClientConfig) (PromQuery, error) {
+	client, err := config.NewClientFromConfig(cfg, "etcd")
+	if err != nil {
+		return nil, err
+	}
+	return &EtcdMetrics{endpoints: endpoints, client: client}, nil
+}
+
+// metricsQuery is a parsed EtcdMetrics query.  divisor is empty when the query
+// is a single metric.
+type metricsQuery struct {
+	metric  string
+	divisor string
+}
+
+func parseMetricsQuery(query string) (metricsQuery, error) {
+	parts := strings.Split(query, "/")
+	if len(parts) > 2 {
+		return metricsQuery{}, fmt.Errorf("expected a metric name or `metric / metric`")
+	}
+	for i, part := range parts {
+		parts[i] = strings.TrimSpace(part)
+		if !model.IsValidLegacyMetricName(parts[i]) {
+			return metricsQuery{}, fmt.Errorf("%q is not a metric name", parts[i])
+		}
+	}
+	q := metricsQuery{metric: parts[0]}
+	if len(parts) == 2 {
+		q.divisor = parts[1]
+	}
+	return q, nil
+}
+
+// IsAlertFiring isn't supported, since etcd doesn't evaluate alerts.
+func (e *EtcdMetrics) IsAlertFiring(_ context.Context, alertName string) (bool, error) {
+	return false, fmt.Errorf("alert %q can't be checked by scraping etcd metrics", alertName)
+}
+
+// FiringAlerts isn't supported, since etcd doesn't evaluate alerts.
+func (e *EtcdMetrics) FiringAlerts(context.Context) ([]model.LabelSet, error) {
+	return nil, fmt.Errorf("alerts can't be checked by scraping etcd metrics")
+}
+
+// QueryValue evaluates query against every member and returns the largest
+// value.  Members that can't be scraped are skipped, so an error is only
+// returned if none of them could be.
+func (e *EtcdMetrics) QueryValue(ctx context.Context, query string) (float64, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	q, err := parseMetricsQuery(query)
+	if err != nil {
+		return 0, err
+	}
+
+	var largest float64
+	var found bool
+	var errs []error
+	for _, endpoint := range e.endpoints {
+		value, err := e.queryMember(ctx, endpoint, q)
+		if err != nil {
+			log.Error(err, "Error scraping etcd member", "endpoint", endpoint)
+			errs = append(errs, err)
+			continue
+		}
+		if !found || value > largest {
+			largest = value
+			found = true
+		}
+	}
+	if !found {
+		return 0, fmt.Errorf("no etcd member could be scraped for %q: %w", query, errors.Join(errs...))
+	}
+	return largest, nil
+}
+
+func (e *EtcdMetrics) queryMember(ctx context.Context, endpoint string, q metricsQuery) (float64, error) {
+	families, err := e.scrape(ctx, endpoint)
+	if err != nil {
+		return 0, err
+	}
+
+	value, err := familyValue(families, q.metric)
+	if err != nil {
+		return 0, err
+	}
+	if q.divisor == "" {
+		return value, nil
+	}
+	divisor, err := familyValue(families, q.divisor)
+	if err != nil {
+		return 0, err
+	}
+	if divisor == 0 {
+		return 0, fmt.Errorf("%s is zero", q.divisor)
+	}
+	return value / divisor, nil
+}
+
+func (e *EtcdMetrics) scrape(ctx context.Context, endpoint string) (map[string]*dto.MetricFamily, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	families, err := func() (map[string]*dto.MetricFamily, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", string(expfmt.NewFormat(expfmt.TypeTextPlain)))
+		resp, err := e.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		parser := expfmt.TextParser{}
+		return parser.TextToMetricFamilies(resp.Body)
+	}()
+	recordQuery("scrape", start, err)
+	return families, err
+}
+
+// familyValue returns the largest value of the gauge, counter or untyped
+// metric with the name.
+func familyValue(families map[string]*dto.MetricFamily, name string) (float64, error) {
+	family, ok := families[name]
+	if !ok || len(family.GetMetric()) == 0 {
+		return 0, fmt.Errorf("metric %s not found", name)
+	}
+
+	var largest float64
+	for i, m := range family.GetMetric() {
+		var value float64
+		switch {
+		case m.GetGauge() != nil:
+			value = m.GetGauge().GetValue()
+		case m.GetCounter() != nil:
+			value = m.GetCounter().GetValue()
+		case m.GetUntyped() != nil:
+			value = m.GetUntyped().GetValue()
+		default:
+			return 0, fmt.Errorf("metric %s has unsupported type %s", name, family.GetType())
+		}
+		if i == 0 || value > largest {
+			largest = value
+		}
+	}
+	return largest, nil
+}
+
+// QueryRange isn't supported.
+func (e *EtcdMetrics) QueryRange(_ context.Context, query string, _, _ time.Time, _ time.Duration) ([]model.SamplePair, error) {
+	return nil, fmt.Errorf("range query %q needs history, which etcd metrics don't keep", query)
+}
@@ -0,0 +1,111 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	etcd_shield "github.com/konflux-ci/etcd-shield/pkg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/common/config"
+)
+
+// etcdMember serves canned etcd metrics for a member with the given database
+// sizes.
+func etcdMember(size, inUse, quota float64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintf(w, `# HELP etcd_mvcc_db_total_size_in_bytes Total size of the underlying database physically allocated in bytes.
+# TYPE etcd_mvcc_db_total_size_in_bytes gauge
+etcd_mvcc_db_total_size_in_bytes %g
+# HELP etcd_mvcc_db_total_size_in_use_in_bytes Total size of the underlying database logically in use in bytes.
+# TYPE etcd_mvcc_db_total_size_in_use_in_bytes gauge
+etcd_mvcc_db_total_size_in_use_in_bytes %g
+# HELP etcd_server_quota_backend_bytes Current backend storage quota size in bytes.
+# TYPE etcd_server_quota_backend_bytes gauge
+etcd_server_quota_backend_bytes %g
+`, size, inUse, quota)
+	}))
+}
+
+var _ = Describe("Pkg/EtcdMetrics", func() {
+	var members []*httptest.Server
+
+	BeforeEach(func() {
+		members = []*httptest.Server{
+			etcdMember(4e9, 3e9, 8e9),
+			etcdMember(6e9, 2e9, 8e9),
+		}
+		DeferCleanup(func() {
+			for _, member := range members {
+				member.Close()
+			}
+		})
+	})
+
+	source := func(endpoints ...string) etcd_shield.PromQuery {
+		etcd, err := etcd_shield.NewEtcdMetrics(endpoints, config.HTTPClientConfig{})
+		Expect(err).NotTo(HaveOccurred())
+		return etcd
+	}
+
+	It("Should return the largest value across members", func(ctx context.Context) {
+		etcd := source(members[0].URL, members[1].URL)
+		Expect(etcd.QueryValue(ctx, "etcd_mvcc_db_total_size_in_bytes")).To(BeEquivalentTo(6e9))
+		Expect(etcd.QueryValue(ctx, "etcd_mvcc_db_total_size_in_use_in_bytes")).To(BeEquivalentTo(3e9))
+	})
+
+	It("Should divide one metric by another", func(ctx context.Context) {
+		etcd := source(members[0].URL, members[1].URL)
+		Expect(etcd.QueryValue(ctx, "etcd_mvcc_db_total_size_in_bytes / etcd_server_quota_backend_bytes")).
+			To(BeNumerically("~", 0.75))
+	})
+
+	It("Should skip members that can't be scraped", func(ctx context.Context) {
+		down := members[1].URL
+		members[1].Close()
+		etcd := source(members[0].URL, down)
+		Expect(etcd.QueryValue(ctx, "etcd_mvcc_db_total_size_in_bytes")).To(BeEquivalentTo(4e9))
+
+		members[0].Close()
+		_, err := etcd.QueryValue(ctx, "etcd_mvcc_db_total_size_in_bytes")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should fail on unknown metrics and alerts", func(ctx context.Context) {
+		etcd := source(members[0].URL)
+		_, err := etcd.QueryValue(ctx, "etcd_not_a_metric")
+		Expect(err).To(MatchError(ContainSubstring("not found")))
+		_, err = etcd.IsAlertFiring(ctx, "EtcdDatabaseQuotaLowSpace")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should only accept metric queries in the config", func() {
+		_, err := etcd_shield.ParseConfig([]byte(`
+destName: etcd-shield-state
+destNamespace: etcd-shield
+source: etcdMetrics
+etcdMetrics:
+  endpoints:
+  - https://10.0.0.1:2379/metrics
+prometheus:
+  query: sum(etcd_mvcc_db_total_size_in_bytes)
+`), etcd_shield.RoleAll)
+		Expect(err).To(MatchError(ContainSubstring("prometheus.query")))
+	})
+})
@@ -0,0 +1,210 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+const (
+	// StatusDBSize is the EtcdStatus query for the physically allocated size
+	// of the database.
+	StatusDBSize = "dbSize"
+	// StatusDBSizeInUse is the EtcdStatus query for the logically used size of
+	// the database.
+	StatusDBSizeInUse = "dbSizeInUse"
+)
+
+// AlarmSource reports the alarms raised by etcd itself.
+type AlarmSource interface {
+	// ActiveAlarms returns the names of the alarms, such as NOSPACE, active on
+	// any member.
+	ActiveAlarms(context.Context) ([]string, error)
+}
+
+// EtcdStatus is a PromQuery that calls the maintenance Status API of each etcd
+// member directly.  Queries are either dbSize or dbSizeInUse, and the largest
+// value across members is used.  Alerts are etcd alarms, such as NOSPACE,
+// which are firing while any member reports them.
+type EtcdStatus struct {
+	endpoints []string
+	client    *clientv3.Client
+}
+
+var _ PromQuery = &EtcdStatus{}
+var _ AlarmSource = &EtcdStatus{}
+var _ io.Closer = &EtcdStatus{}
+
+func NewEtcdStatus(endpoints []string, tlsConfig *config.TLSConfig) (*EtcdStatus, error) {
+	var tlsClient *tls.Config
+	if tlsConfig != nil {
+		var err error
+		tlsClient, err = config.NewTLSConfig(tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		TLS:         tlsClient,
+		DialTimeout: 5 * time.Second,
+		// errors are logged as each member is queried
+		Logger: zap.NewNop(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &EtcdStatus{endpoints: endpoints, client: client}, nil
+}
+
+// isEtcdAlarm indicates whether name is an alarm etcd can raise.
+func isEtcdAlarm(name string) bool {
+	value, ok := etcdserverpb.AlarmType_value[name]
+	return ok && value != int32(etcdserverpb.AlarmType_NONE)
+}
+
+// Close disconnects from the etcd members.
+func (e *EtcdStatus) Close() error {
+	return e.client.Close()
+}
+
+// IsAlertFiring indicates whether any member reports the etcd alarm with the
+// name.
+func (e *EtcdStatus) IsAlertFiring(ctx context.Context, alarm string) (bool, error) {
+	alarms, err := e.ActiveAlarms(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, active := range alarms {
+		if active == alarm {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// FiringAlerts returns the active alarms as alerts named after them, such as
+// {alertname="NOSPACE"}.
+func (e *EtcdStatus) FiringAlerts(ctx context.Context) ([]model.LabelSet, error) {
+	alarms, err := e.ActiveAlarms(ctx)
+	if err != nil {
+		return nil, err
+	}
+	firing := make([]model.LabelSet, 0, len(alarms))
+	for _, alarm := range alarms {
+		firing = append(firing, model.LabelSet{model.AlertNameLabel: model.LabelValue(alarm)})
+	}
+	return firing, nil
+}
+
+// ActiveAlarms returns the alarms reported by any member that responded.
+func (e *EtcdStatus) ActiveAlarms(ctx context.Context) ([]string, error) {
+	statuses, err := e.statuses(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	alarms := []string{}
+	seen := map[string]bool{}
+	for _, status := range statuses {
+		for _, msg := range status.Errors {
+			alarm := parseAlarm(msg)
+			if alarm != "" && !seen[alarm] {
+				seen[alarm] = true
+				alarms = append(alarms, alarm)
+			}
+		}
+	}
+	return alarms, nil
+}
+
+// QueryValue returns the largest dbSize or dbSizeInUse across members.
+func (e *EtcdStatus) QueryValue(ctx context.Context, query string) (float64, error) {
+	if query != StatusDBSize && query != StatusDBSizeInUse {
+		return 0, fmt.Errorf("unsupported etcd status query %q, expected %s or %s", query, StatusDBSize, StatusDBSizeInUse)
+	}
+	statuses, err := e.statuses(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var largest int64
+	for _, status := range statuses {
+		value := status.DbSize
+		if query == StatusDBSizeInUse {
+			value = status.DbSizeInUse
+		}
+		if value > largest {
+			largest = value
+		}
+	}
+	return float64(largest), nil
+}
+
+// statuses returns the status of every member that responded, only failing if
+// none of them did.
+func (e *EtcdStatus) statuses(ctx context.Context) ([]*clientv3.StatusResponse, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	statuses := []*clientv3.StatusResponse{}
+	var errs []error
+	for _, endpoint := range e.endpoints {
+		start := time.Now()
+		status, err := e.client.Status(ctx, endpoint)
+		recordQuery("status", start, err)
+		if err != nil {
+			log.Error(err, "Error fetching etcd member status", "endpoint", endpoint)
+			errs = append(errs, err)
+			continue
+		}
+		statuses = append(statuses, status)
+	}
+	if len(statuses) == 0 {
+		return nil, fmt.Errorf("no etcd member returned its status: %w", errors.Join(errs...))
+	}
+	return statuses, nil
+}
+
+// parseAlarm picks the alarm name out of a status error, which looks like
+// `memberID:1234 alarm:NOSPACE`.  Errors that aren't alarms return "".
+func parseAlarm(msg string) string {
+	for _, part := range strings.Fields(msg) {
+		if alarm, ok := strings.CutPrefix(part, "alarm:"); ok {
+			return alarm
+		}
+	}
+	return ""
+}
+
+// QueryRange isn't supported.
+func (e *EtcdStatus) QueryRange(_ context.Context, query string, _, _ time.Time, _ time.Duration) ([]model.SamplePair, error) {
+	return nil, fmt.Errorf("range query %q needs history, which etcd status doesn't keep", query)
+}
@@ -0,0 +1,155 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	etcd_shield "github.com/konflux-ci/etcd-shield/pkg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// freeURL returns a URL on a local port nothing is listening on.
+func freeURL() url.URL {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	defer listener.Close()
+	return url.URL{Scheme: "http", Host: listener.Addr().String()}
+}
+
+// startEtcd runs a single member etcd cluster in-process, returning its client
+// URL.
+func startEtcd() string {
+	cfg := embed.NewConfig()
+	cfg.Dir = GinkgoT().TempDir()
+	cfg.LogLevel = "error"
+	client, peer := freeURL(), freeURL()
+	cfg.ListenClientUrls = []url.URL{client}
+	cfg.AdvertiseClientUrls = []url.URL{client}
+	cfg.ListenPeerUrls = []url.URL{peer}
+	cfg.AdvertisePeerUrls = []url.URL{peer}
+	cfg.InitialCluster = fmt.Sprintf("%s=%s", cfg.Name, peer.String())
+
+	etcd, err := embed.StartEtcd(cfg)
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(etcd.Close)
+	Eventually(etcd.Server.ReadyNotify()).WithTimeout(30 * time.Second).Should(BeClosed())
+	return client.String()
+}
+
+var _ = Describe("Pkg/EtcdStatus", Ordered, func() {
+	var endpoint string
+	var status *etcd_shield.EtcdStatus
+
+	BeforeAll(func() {
+		endpoint = startEtcd()
+	})
+
+	BeforeEach(func() {
+		var err error
+		status, err = etcd_shield.NewEtcdStatus([]string{endpoint}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(status.Close)
+	})
+
+	// setAlarm raises or clears the NOSPACE alarm on the member.
+	setAlarm := func(ctx context.Context, action etcdserverpb.AlarmRequest_AlarmAction) {
+		cli, err := clientv3.New(clientv3.Config{Endpoints: []string{endpoint}})
+		Expect(err).NotTo(HaveOccurred())
+		defer cli.Close()
+		member, err := cli.Status(ctx, endpoint)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = etcdserverpb.NewMaintenanceClient(cli.ActiveConnection()).Alarm(ctx, &etcdserverpb.AlarmRequest{
+			Action:   action,
+			MemberID: member.Header.MemberId,
+			Alarm:    etcdserverpb.AlarmType_NOSPACE,
+		})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	It("Should report the database size", func(ctx context.Context) {
+		size, err := status.QueryValue(ctx, etcd_shield.StatusDBSize)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(size).To(BeNumerically(">", 0))
+
+		inUse, err := status.QueryValue(ctx, etcd_shield.StatusDBSizeInUse)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inUse).To(BeNumerically(">", 0))
+		Expect(inUse).To(BeNumerically("<=", size))
+
+		_, err = status.QueryValue(ctx, "etcd_mvcc_db_total_size_in_bytes")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should report active alarms", func(ctx context.Context) {
+		Expect(status.IsAlertFiring(ctx, "NOSPACE")).To(BeFalse())
+
+		setAlarm(ctx, etcdserverpb.AlarmRequest_ACTIVATE)
+		DeferCleanup(setAlarm, etcdserverpb.AlarmRequest_DEACTIVATE)
+		Expect(status.IsAlertFiring(ctx, "NOSPACE")).To(BeTrue())
+		Expect(status.ActiveAlarms(ctx)).To(ConsistOf("NOSPACE"))
+	})
+
+	It("Should close admission on an alarm alongside prometheus", func(ctx context.Context) {
+		cfg := etcd_shield.Config{
+			Prometheus: etcd_shield.PrometheusConfig{AlertName: "deny"},
+			EtcdStatus: &etcd_shield.EtcdStatusConfig{Endpoints: []string{endpoint}, Alarms: []string{"NOSPACE"}},
+		}
+		// prometheus itself is faked, with the alarms coming from etcd
+		source := struct {
+			*fakePrometheus
+			etcd_shield.AlarmSource
+		}{&fakePrometheus{firing: map[string]bool{}}, status}
+		state := etcd_shield.NewState(fake.NewClientBuilder().Build(), types.NamespacedName{Name: "state", Namespace: "etcd-shield"})
+		querier := etcd_shield.NewQuerier(source, state, cfg)
+
+		Expect(querier.Process(ctx)).To(Succeed())
+		Expect(state.ReadConfig(ctx)).To(HaveField("Level", etcd_shield.LevelOpen))
+
+		setAlarm(ctx, etcdserverpb.AlarmRequest_ACTIVATE)
+		DeferCleanup(setAlarm, etcdserverpb.AlarmRequest_DEACTIVATE)
+		Expect(querier.Process(ctx)).To(Succeed())
+		record, err := state.ReadConfig(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(record.Level).To(Equal(etcd_shield.LevelClosed))
+		Expect(record.Reason).To(Equal("etcd alarm NOSPACE is active"))
+	})
+
+	It("Should require alarms to be known to etcd", func() {
+		cfg := etcd_shield.Config{
+			DestName:      "etcd-shield-state",
+			DestNamespace: "etcd-shield",
+			Source:        etcd_shield.SourceEtcdStatus,
+			Prometheus:    etcd_shield.PrometheusConfig{AlertName: "EtcdNoSpace"},
+			EtcdStatus:    &etcd_shield.EtcdStatusConfig{Endpoints: []string{endpoint}, Alarms: []string{"NONE"}},
+		}
+		cfg.Default()
+		fields := []string{}
+		for _, err := range cfg.Validate(etcd_shield.RoleAll) {
+			fields = append(fields, err.Field)
+		}
+		Expect(fields).To(ConsistOf("prometheus.alertName", "etcdStatus.alarms[0]"))
+	})
+})
@@ -0,0 +1,101 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Exemptions decides whether an object is admitted regardless of the
+// admission level.
+type Exemptions struct {
+	client            client.Reader
+	namespaces        sets.Set[string]
+	namespaceSelector labels.Selector
+	objectSelector    labels.Selector
+	annotations       map[string]string
+}
+
+// NewExemptions builds an Exemptions from its config.  The client is only used
+// to look up namespace labels, and may be nil if no namespace selector is
+// configured.
+func NewExemptions(cli client.Reader, cfg ExemptionConfig) (*Exemptions, error) {
+	exemptions := Exemptions{
+		client:      cli,
+		namespaces:  sets.New(cfg.Namespaces...),
+		annotations: cfg.Annotations,
+	}
+
+	if cfg.NamespaceSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(cfg.NamespaceSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace selector: %w", err)
+		}
+		if cli == nil {
+			return nil, fmt.Errorf("namespace selector requires a client")
+		}
+		exemptions.namespaceSelector = selector
+	}
+
+	if cfg.ObjectSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(cfg.ObjectSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid object selector: %w", err)
+		}
+		exemptions.objectSelector = selector
+	}
+
+	return &exemptions, nil
+}
+
+// IsExempt reports whether obj should always be admitted.  Cheap checks on the
+// object itself run first, so the namespace is only looked up when needed.
+func (e *Exemptions) IsExempt(ctx context.Context, obj metav1.Object) (bool, error) {
+	if e.namespaces.Has(obj.GetNamespace()) {
+		return true, nil
+	}
+
+	if e.objectSelector != nil && e.objectSelector.Matches(labels.Set(obj.GetLabels())) {
+		return true, nil
+	}
+
+	objAnnotations := obj.GetAnnotations()
+	for key, value := range e.annotations {
+		if actual, ok := objAnnotations[key]; ok && actual == value {
+			return true, nil
+		}
+	}
+
+	if e.namespaceSelector != nil {
+		namespace := metav1.PartialObjectMetadata{}
+		namespace.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Namespace"))
+		err := e.client.Get(ctx, client.ObjectKey{Name: obj.GetNamespace()}, &namespace)
+		if err != nil {
+			return false, fmt.Errorf("failed to look up namespace %s: %w", obj.GetNamespace(), err)
+		}
+		if e.namespaceSelector.Matches(labels.Set(namespace.GetLabels())) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
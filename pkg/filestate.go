@@ -0,0 +1,151 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// FileState is a read-only StateManager for the state ConfigMap mounted as a
+// volume, so webhooks can read it without any access to the API server.  Path
+// is either the mounted directory, with a file per key, or a single file
+// holding the state record.  It's polled for changes, like ConfigWatcher, and
+// the record is swapped in whenever the files change.
+type FileState struct {
+	path     string
+	interval time.Duration
+
+	// mu serializes loads, so a slower one can't swap in older data
+	mu     sync.Mutex
+	data   map[string]string
+	record atomic.Pointer[StateRecord]
+}
+
+var _ StateManager = &FileState{}
+var _ manager.Runnable = &FileState{}
+var _ manager.LeaderElectionRunnable = &FileState{}
+
+// NewFileState creates a FileState reading path every interval.  The state is
+// read once up front, so a missing mount is caught on startup.
+func NewFileState(path string, interval time.Duration) (*FileState, error) {
+	state := FileState{path: path, interval: interval}
+	if _, err := state.Check(context.Background()); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (f *FileState) NeedLeaderElection() bool {
+	// every replica reads its own mount
+	return false
+}
+
+func (f *FileState) Start(ctx context.Context) error {
+	l := logr.FromContextOrDiscard(ctx)
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			changed, err := f.Check(ctx)
+			if err != nil {
+				l.Error(err, "failed to read the state", "path", f.path)
+			} else if changed {
+				l.Info("state changed", "path", f.path, "level", f.record.Load().Level)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Check rereads the state, swapping in the record if the files changed since
+// they were last read, which is reported.  On error, the last record is kept.
+func (f *FileState) Check(ctx context.Context) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := f.read()
+	if err != nil {
+		return false, err
+	}
+	if f.data != nil && maps.Equal(data, f.data) {
+		return false, nil
+	}
+	f.data = data
+	f.record.Store(parseState(data))
+	return true, nil
+}
+
+// read loads the files into ConfigMap data.
+func (f *FileState) read() (map[string]string, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		contents, err := os.ReadFile(f.path)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{STATE_KEY: string(contents)}, nil
+	}
+
+	entries, err := os.ReadDir(f.path)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]string{}
+	for _, entry := range entries {
+		// mounted ConfigMaps keep their real files in hidden directories
+		if strings.HasPrefix(entry.Name(), ".") || entry.IsDir() {
+			continue
+		}
+		contents, err := os.ReadFile(filepath.Join(f.path, entry.Name()))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// swapped out from under us, the next check will see the rest
+				continue
+			}
+			return nil, err
+		}
+		data[entry.Name()] = string(contents)
+	}
+	return data, nil
+}
+
+// ReadConfig returns the last record read, which callers mustn't modify since
+// it's shared.
+func (f *FileState) ReadConfig(context.Context) (*StateRecord, error) {
+	return f.record.Load(), nil
+}
+
+// WriteConfig always fails, since the state is only written by the querier
+// through the API server.
+func (f *FileState) WriteConfig(context.Context, *StateRecord) error {
+	return fmt.Errorf("state read from %s is read-only", f.path)
+}
@@ -0,0 +1,101 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	etcd_shield "github.com/konflux-ci/etcd-shield/pkg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// mountState writes the state ConfigMap for record into dir the way the
+// kubelet mounts ConfigMaps: the files live in a hidden directory, swapped in
+// through the ..data symlink that each key links through.
+func mountState(ctx context.Context, dir, version string, record *etcd_shield.StateRecord) {
+	configMap := stateConfigMap(ctx, record)
+
+	files := filepath.Join(dir, ".."+version)
+	ExpectWithOffset(1, os.Mkdir(files, 0o755)).To(Succeed())
+	for key, value := range configMap.Data {
+		ExpectWithOffset(1, os.WriteFile(filepath.Join(files, key), []byte(value), 0o644)).To(Succeed())
+		link := filepath.Join(dir, key)
+		if _, err := os.Lstat(link); os.IsNotExist(err) {
+			ExpectWithOffset(1, os.Symlink(filepath.Join("..data", key), link)).To(Succeed())
+		}
+	}
+	ExpectWithOffset(1, os.Symlink(".."+version, filepath.Join(dir, "..data_tmp"))).To(Succeed())
+	ExpectWithOffset(1, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data"))).To(Succeed())
+}
+
+var _ = Describe("Pkg/FileState", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	It("Should read the state from a mounted ConfigMap", func(ctx context.Context) {
+		mountState(ctx, dir, "1", &etcd_shield.StateRecord{Level: etcd_shield.LevelClosed, Reason: "full"})
+		state, err := etcd_shield.NewFileState(dir, time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.ReadConfig(ctx)).To(HaveField("Reason", "full"))
+
+		changed, err := state.Check(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeFalse())
+
+		mountState(ctx, dir, "2", &etcd_shield.StateRecord{Level: etcd_shield.LevelThrottled})
+		changed, err = state.Check(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeTrue())
+		Expect(state.ReadConfig(ctx)).To(HaveField("Level", etcd_shield.LevelThrottled))
+	})
+
+	It("Should read the state record from a file", func(ctx context.Context) {
+		path := filepath.Join(dir, "state")
+		Expect(os.WriteFile(path, []byte(`{"version":1,"level":"closed"}`), 0o644)).To(Succeed())
+		state, err := etcd_shield.NewFileState(path, time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.ReadConfig(ctx)).To(HaveField("Level", etcd_shield.LevelClosed))
+
+		// a failed read keeps the last record
+		Expect(os.Remove(path)).To(Succeed())
+		_, err = state.Check(ctx)
+		Expect(err).To(HaveOccurred())
+		Expect(state.ReadConfig(ctx)).To(HaveField("Level", etcd_shield.LevelClosed))
+	})
+
+	It("Should treat an empty mount as open", func(ctx context.Context) {
+		state, err := etcd_shield.NewFileState(dir, time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.ReadConfig(ctx)).To(HaveField("Level", etcd_shield.LevelOpen))
+	})
+
+	It("Should fail on a missing mount", func() {
+		_, err := etcd_shield.NewFileState(filepath.Join(dir, "missing"), time.Second)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should refuse writes", func(ctx context.Context) {
+		state, err := etcd_shield.NewFileState(dir, time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelClosed})).To(MatchError(ContainSubstring("read-only")))
+	})
+})
@@ -0,0 +1,116 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// ResourceHandler validates new objects of one configured resource.  Only the
+// parts of an object admission depends on are decoded, so any kind can be
+// guarded without its Go types, and admitting it stays cheap.
+type ResourceHandler struct {
+	webhook *Webhook
+	gvk     schema.GroupVersionKind
+}
+
+// admittedObject is the part of an admitted object that admission is decided
+// on.
+type admittedObject struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		// Status is only read from `PipelineRuns`, to tell queued ones apart.
+		Status string `json:"status"`
+	} `json:"spec"`
+}
+
+var _ admission.Handler = &ResourceHandler{}
+
+// Handler creates the admission handler for the resource of gvk.  Its
+// settings, such as level overrides, are looked up on every request so they
+// follow config reloads.
+func (w *Webhook) Handler(gvk schema.GroupVersionKind) *ResourceHandler {
+	return &ResourceHandler{webhook: w, gvk: gvk}
+}
+
+// Handle admits or denies creating the object in req.  Other operations are
+// always admitted.
+func (h *ResourceHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create {
+		return admission.Allowed("")
+	}
+
+	obj := &admittedObject{}
+	if err := json.Unmarshal(req.Object.Raw, obj); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	queued := h.gvk.GroupKind() == pipelineRunKind.GroupKind() && isQueued(obj.Labels, obj.Spec.Status)
+
+	settings := h.webhook.settings.Load()
+	warnings, err := h.webhook.validate(ctx, settings, settings.resources[h.gvk], obj, queued)
+	if err != nil {
+		var status apierrors.APIStatus
+		if errors.As(err, &status) {
+			result := status.Status()
+			return admission.Response{AdmissionResponse: admissionv1.AdmissionResponse{
+				Allowed:  false,
+				Result:   &result,
+				Warnings: warnings,
+			}}
+		}
+		return admission.Denied(err.Error()).WithWarnings(warnings...)
+	}
+	return admission.Allowed("").WithWarnings(warnings...)
+}
+
+// levelFor is the level enforced for resource while the querier decided on
+// level, applying its level overrides.  resource may be nil if no resource is
+// configured.
+func (resource *ResourceConfig) levelFor(level Level) Level {
+	if resource == nil {
+		return level
+	}
+	if override, ok := resource.Levels[level]; ok {
+		return override
+	}
+	return level
+}
+
+// enforcementOf is how decisions about resource are enforced, which is
+// enforced if no resource is configured.
+func enforcementOf(resource *ResourceConfig) EnforcementMode {
+	if resource == nil || resource.Enforcement == "" {
+		return EnforcementEnforce
+	}
+	return resource.Enforcement
+}
+
+// kindOf names the kind of resource in messages, which is a `PipelineRun` if
+// no resource is configured.
+func kindOf(resource *ResourceConfig) string {
+	if resource == nil {
+		return pipelineRunKind.Kind
+	}
+	return resource.Kind
+}
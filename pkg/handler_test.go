@@ -0,0 +1,165 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	etcd_shield "github.com/konflux-ci/etcd-shield/pkg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	tektonv1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// admissionRequest is a request to create an object of apiVersion and kind.
+func admissionRequest(operation admissionv1.Operation, apiVersion, kind, name string) admission.Request {
+	return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: operation,
+		Namespace: "tenant",
+		Name:      name,
+		Object: runtime.RawExtension{Raw: []byte(fmt.Sprintf(
+			`{"apiVersion":%q,"kind":%q,"metadata":{"namespace":"tenant","name":%q}}`, apiVersion, kind, name))},
+	}}
+}
+
+// pipelineRunRequest is a request to create pr.
+func pipelineRunRequest(pr *tektonv1.PipelineRun) admission.Request {
+	pr = pr.DeepCopy()
+	pr.SetGroupVersionKind(pipelineRunGVK)
+	raw, err := json.Marshal(pr)
+	if err != nil {
+		// it's also used by benchmarks, outside of any spec
+		panic(err)
+	}
+	return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: admissionv1.Create,
+		Namespace: pr.Namespace,
+		Name:      pr.Name,
+		Object:    runtime.RawExtension{Raw: raw},
+	}}
+}
+
+var pipelineRunGVK = tektonv1.SchemeGroupVersion.WithKind("PipelineRun")
+
+var _ = Describe("Pkg/Handler", func() {
+	var state etcd_shield.StateManager
+	var webhook *etcd_shield.Webhook
+
+	taskRun := etcd_shield.ResourceConfig{Group: "tekton.dev", Version: "v1", Kind: "TaskRun", Levels: map[etcd_shield.Level]etcd_shield.Level{
+		etcd_shield.LevelThrottled: etcd_shield.LevelClosed,
+	}}
+	job := etcd_shield.ResourceConfig{Group: "batch", Version: "v1", Kind: "Job"}
+
+	BeforeEach(func() {
+		cli := fake.NewClientBuilder().Build()
+		state = etcd_shield.NewState(cli, types.NamespacedName{Name: "state", Namespace: "etcd-shield"})
+		cfg := etcd_shield.Config{
+			Resources: []etcd_shield.ResourceConfig{taskRun, job},
+			Throttle:  &etcd_shield.ThrottleConfig{Fraction: 1},
+		}
+		cfg.Default()
+		var err error
+		webhook, err = etcd_shield.NewWebhook(state, cfg, cli)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should guard any kind of object", func(ctx context.Context) {
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelClosed})).To(Succeed())
+		response := webhook.Handler(job.GroupVersionKind()).Handle(ctx, admissionRequest(admissionv1.Create, "batch/v1", "Job", "backup"))
+		Expect(response.Allowed).To(BeFalse())
+		Expect(response.Result.Message).To(Equal("Job admission currently not allowed"))
+
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelOpen})).To(Succeed())
+		response = webhook.Handler(job.GroupVersionKind()).Handle(ctx, admissionRequest(admissionv1.Create, "batch/v1", "Job", "backup"))
+		Expect(response.Allowed).To(BeTrue())
+	})
+
+	It("Should apply each resource's level overrides", func(ctx context.Context) {
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelThrottled})).To(Succeed())
+
+		response := webhook.Handler(taskRun.GroupVersionKind()).Handle(ctx, admissionRequest(admissionv1.Create, "tekton.dev/v1", "TaskRun", "build"))
+		Expect(response.Allowed).To(BeFalse())
+		Expect(response.Result.Message).To(Equal("TaskRun admission currently not allowed: admission is throttled, which is closed for TaskRun"))
+		Expect(response.Result.Details.Causes).To(ContainElement(metav1.StatusCause{Type: etcd_shield.CauseLevel, Message: "closed"}))
+
+		response = webhook.Handler(job.GroupVersionKind()).Handle(ctx, admissionRequest(admissionv1.Create, "batch/v1", "Job", "build"))
+		Expect(response.Allowed).To(BeTrue())
+	})
+
+	It("Should explain denials by a stale state's policy rather than the record", func(ctx context.Context) {
+		cli := fake.NewClientBuilder().Build()
+		cfg := etcd_shield.Config{
+			Resources: []etcd_shield.ResourceConfig{job},
+			Staleness: etcd_shield.StalenessConfig{
+				MaxAge: etcd_shield.NewDuration(time.Minute),
+				Policy: etcd_shield.StalePolicyFailClosed,
+			},
+		}
+		cfg.Default()
+		webhook, err := etcd_shield.NewWebhook(state, cfg, cli)
+		Expect(err).NotTo(HaveOccurred())
+		checked := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{
+			Level:              etcd_shield.LevelOpen,
+			Reason:             "alert foo is not firing",
+			LastTransitionTime: metav1.NewTime(checked),
+			LastCheckTime:      metav1.NewTime(checked),
+		})).To(Succeed())
+
+		response := webhook.Handler(job.GroupVersionKind()).Handle(ctx, admissionRequest(admissionv1.Create, "batch/v1", "Job", "backup"))
+		Expect(response.Allowed).To(BeFalse())
+		Expect(response.Result.Message).To(HavePrefix("Job admission currently not allowed: etcd-shield state was last refreshed "))
+		Expect(response.Result.Message).NotTo(ContainSubstring("not firing"))
+		Expect(response.Result.Message).NotTo(ContainSubstring("since"))
+		Expect(response.Result.Details.Causes).To(ContainElement(metav1.StatusCause{Type: etcd_shield.CauseLevel, Message: "closed"}))
+		Expect(response.Result.Details.Causes).NotTo(ContainElement(HaveField("Type", etcd_shield.CauseSince)))
+	})
+
+	It("Should only guard creates", func(ctx context.Context) {
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelClosed})).To(Succeed())
+		response := webhook.Handler(job.GroupVersionKind()).Handle(ctx, admissionRequest(admissionv1.Update, "batch/v1", "Job", "backup"))
+		Expect(response.Allowed).To(BeTrue())
+	})
+
+	It("Should only warn about or audit denials when not enforcing", func(ctx context.Context) {
+		cli := fake.NewClientBuilder().Build()
+		warned, audited := job, job
+		warned.Enforcement = etcd_shield.EnforcementWarn
+		audited.Kind = "CronJob"
+		audited.Enforcement = etcd_shield.EnforcementAudit
+		cfg := etcd_shield.Config{Resources: []etcd_shield.ResourceConfig{warned, audited}}
+		cfg.Default()
+		webhook, err := etcd_shield.NewWebhook(state, cfg, cli)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelClosed})).To(Succeed())
+
+		response := webhook.Handler(warned.GroupVersionKind()).Handle(ctx, admissionRequest(admissionv1.Create, "batch/v1", "Job", "backup"))
+		Expect(response.Allowed).To(BeTrue())
+		Expect(response.Warnings).To(ConsistOf("etcd-shield would have denied this: Job admission currently not allowed"))
+
+		response = webhook.Handler(audited.GroupVersionKind()).Handle(ctx, admissionRequest(admissionv1.Create, "batch/v1", "CronJob", "backup"))
+		Expect(response.Allowed).To(BeTrue())
+		Expect(response.Warnings).To(BeEmpty())
+	})
+})
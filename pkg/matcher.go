@@ -0,0 +1,133 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// MatchType is the comparison a LabelMatcher makes.
+type MatchType string
+
+const (
+	MatchEqual     MatchType = "="
+	MatchNotEqual  MatchType = "!="
+	MatchRegexp    MatchType = "=~"
+	MatchNotRegexp MatchType = "!~"
+)
+
+// LabelMatcher matches a single label of an alert, written the same way as in
+// PromQL or Alertmanager, such as `cluster="stone-prd-1"` or `severity=~"warning|critical"`.
+type LabelMatcher struct {
+	Name  string
+	Type  MatchType
+	Value string
+
+	re *regexp.Regexp
+}
+
+// ParseMatcher parses a matcher such as `cluster="stone-prd-1"`.  The value
+// may be left unquoted.
+func ParseMatcher(s string) (*LabelMatcher, error) {
+	s = strings.TrimSpace(s)
+	end := strings.IndexAny(s, "=!")
+	if end <= 0 {
+		return nil, fmt.Errorf("matcher %q has no label name", s)
+	}
+	m := LabelMatcher{Name: strings.TrimSpace(s[:end])}
+	if !model.LabelName(m.Name).IsValidLegacy() {
+		return nil, fmt.Errorf("matcher %q has invalid label name %q", s, m.Name)
+	}
+
+	rest := s[end:]
+	for _, t := range []MatchType{MatchRegexp, MatchNotRegexp, MatchNotEqual, MatchEqual} {
+		if strings.HasPrefix(rest, string(t)) {
+			m.Type = t
+			rest = rest[len(t):]
+			break
+		}
+	}
+	if m.Type == "" {
+		return nil, fmt.Errorf("matcher %q has no operator, expected one of =, !=, =~ or !~", s)
+	}
+
+	m.Value = strings.TrimSpace(rest)
+	if strings.HasPrefix(m.Value, `"`) {
+		value, err := strconv.Unquote(m.Value)
+		if err != nil {
+			return nil, fmt.Errorf("matcher %q has invalid quoted value: %w", s, err)
+		}
+		m.Value = value
+	}
+
+	if m.Type == MatchRegexp || m.Type == MatchNotRegexp {
+		re, err := regexp.Compile("^(?:" + m.Value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("matcher %q has invalid regexp: %w", s, err)
+		}
+		m.re = re
+	}
+	return &m, nil
+}
+
+// ParseMatchers parses each of the matchers.
+func ParseMatchers(matchers []string) ([]*LabelMatcher, error) {
+	parsed := make([]*LabelMatcher, 0, len(matchers))
+	for _, s := range matchers {
+		m, err := ParseMatcher(s)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, m)
+	}
+	return parsed, nil
+}
+
+// Matches indicates whether the label value matches.  A missing label matches
+// as an empty value, as it does in Prometheus.
+func (m *LabelMatcher) Matches(value string) bool {
+	switch m.Type {
+	case MatchEqual:
+		return value == m.Value
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(value)
+	case MatchNotRegexp:
+		return !m.re.MatchString(value)
+	default:
+		return false
+	}
+}
+
+// String returns the matcher with its value quoted.
+func (m *LabelMatcher) String() string {
+	return fmt.Sprintf("%s%s%q", m.Name, m.Type, m.Value)
+}
+
+// matchesAll indicates whether labels match every one of matchers.
+func matchesAll(matchers []*LabelMatcher, labels model.LabelSet) bool {
+	for _, m := range matchers {
+		if !m.Matches(string(labels[model.LabelName(m.Name)])) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,146 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Outcomes of an admission decision.
+const (
+	OutcomeAllowed   = "allowed"
+	OutcomeExempt    = "exempt"
+	OutcomeThrottled = "throttled"
+	OutcomeRamping   = "ramping"
+	OutcomeDenied    = "denied"
+	OutcomeQueued    = "queued"
+	OutcomeError     = "error"
+)
+
+// Gauges without labels are vectors all the same, so they're only exported once
+// they've been set, rather than as 0 by every replica.
+var (
+	allowGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "etcd_shield_allow",
+		Help: "1 if new PipelineRuns are allowed, 0 if they are throttled or denied.",
+	}, nil)
+
+	levelGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "etcd_shield_level",
+		Help: "1 for the current admission level, 0 for the others.",
+	}, []string{"level"})
+
+	transitionsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "etcd_shield_transitions_total",
+		Help: "Number of admission level transitions, by direction.",
+	}, []string{"from", "to"})
+
+	queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "etcd_shield_prometheus_query_duration_seconds",
+		Help:    "Latency of queries made to prometheus, by query type and result.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"query", "result"})
+
+	endpointUpGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "etcd_shield_prometheus_endpoint_up",
+		Help: "1 if the last query to the prometheus endpoint succeeded, 0 if it failed.",
+	}, []string{"address"})
+
+	timeToQuotaGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "etcd_shield_predicted_time_to_quota_seconds",
+		Help: "Projected time until the etcd database reaches its quota at the current growth rate, +Inf if it isn't growing.",
+	}, nil)
+
+	decisionsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "etcd_shield_admission_decisions_total",
+		Help: "Number of admission decisions, by namespace and outcome.",
+	}, []string{"namespace", "outcome"})
+	unenforcedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "etcd_shield_unenforced_decisions_total",
+		Help: "Number of admission denials that were admitted anyway because of the enforcement mode, by namespace, would-be outcome and mode.",
+	}, []string{"namespace", "outcome", "enforcement"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		allowGauge,
+		levelGauge,
+		transitionsCounter,
+		queryDuration,
+		endpointUpGauge,
+		timeToQuotaGauge,
+		decisionsCounter,
+		unenforcedCounter,
+	)
+}
+
+// recordLevel updates the state gauges, counting a transition if the level
+// changed.
+func recordLevel(previous, current Level) {
+	if current == LevelOpen {
+		allowGauge.WithLabelValues().Set(1)
+	} else {
+		allowGauge.WithLabelValues().Set(0)
+	}
+	for _, level := range []Level{LevelOpen, LevelThrottled, LevelClosed} {
+		if level == current {
+			levelGauge.WithLabelValues(string(level)).Set(1)
+		} else {
+			levelGauge.WithLabelValues(string(level)).Set(0)
+		}
+	}
+
+	if previous != current {
+		transitionsCounter.WithLabelValues(string(previous), string(current)).Inc()
+	}
+}
+
+// recordQuery observes how long a prometheus query that started at start took.
+func recordQuery(query string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	queryDuration.WithLabelValues(query, result).Observe(time.Since(start).Seconds())
+}
+
+// recordEndpointHealth updates whether the prometheus endpoint at address is
+// healthy.
+func recordEndpointHealth(address string, healthy bool) {
+	if healthy {
+		endpointUpGauge.WithLabelValues(address).Set(1)
+	} else {
+		endpointUpGauge.WithLabelValues(address).Set(0)
+	}
+}
+
+// recordProjection updates the projected time until the quota is reached.
+func recordProjection(timeToQuota float64) {
+	timeToQuotaGauge.WithLabelValues().Set(timeToQuota)
+}
+
+// recordUnenforced counts a denial that was admitted anyway because of the
+// enforcement mode.
+func recordUnenforced(namespace, outcome string, mode EnforcementMode) {
+	unenforcedCounter.WithLabelValues(namespace, outcome, string(mode)).Inc()
+}
+
+// recordDecision counts an admission decision.
+func recordDecision(namespace, outcome string) {
+	decisionsCounter.WithLabelValues(namespace, outcome).Inc()
+}
@@ -0,0 +1,110 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield_test
+
+import (
+	"context"
+
+	etcd_shield "github.com/konflux-ci/etcd-shield/pkg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// metricValue returns the value of the gauge or counter with the given name
+// and labels from the controller-runtime registry.
+func metricValue(name string, labels map[string]string) float64 {
+	families, err := metrics.Registry.Gather()
+	Expect(err).NotTo(HaveOccurred())
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metric:
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if labels[label.GetName()] != label.GetValue() {
+					continue metric
+				}
+			}
+			if m.GetGauge() != nil {
+				return m.GetGauge().GetValue()
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+var _ = Describe("Pkg/Metrics", func() {
+	var prom *fakePrometheus
+	var state etcd_shield.StateManager
+
+	BeforeEach(func() {
+		prom = &fakePrometheus{firing: map[string]bool{}}
+		state = etcd_shield.NewState(fake.NewClientBuilder().Build(), types.NamespacedName{Name: "state", Namespace: "etcd-shield"})
+	})
+
+	It("Should expose the admission level and its transitions", func(ctx context.Context) {
+		querier := etcd_shield.NewQuerier(prom, state, etcd_shield.Config{
+			Prometheus: etcd_shield.PrometheusConfig{AlertName: "deny"},
+		})
+		closing := map[string]string{"from": "open", "to": "closed"}
+		before := metricValue("etcd_shield_transitions_total", closing)
+
+		prom.firing["deny"] = true
+		Expect(querier.Process(ctx)).To(Succeed())
+		Expect(querier.Process(ctx)).To(Succeed())
+		Expect(metricValue("etcd_shield_allow", nil)).To(BeEquivalentTo(0))
+		Expect(metricValue("etcd_shield_level", map[string]string{"level": "closed"})).To(BeEquivalentTo(1))
+		Expect(metricValue("etcd_shield_transitions_total", closing)).To(Equal(before + 1))
+
+		prom.firing["deny"] = false
+		Expect(querier.Process(ctx)).To(Succeed())
+		Expect(metricValue("etcd_shield_allow", nil)).To(BeEquivalentTo(1))
+		Expect(metricValue("etcd_shield_level", map[string]string{"level": "closed"})).To(BeEquivalentTo(0))
+	})
+
+	It("Should count admission decisions by namespace and outcome", func(ctx context.Context) {
+		webhook, err := etcd_shield.NewWebhook(state, etcd_shield.Config{}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		denied := map[string]string{"namespace": "metrics", "outcome": etcd_shield.OutcomeDenied}
+		before := metricValue("etcd_shield_admission_decisions_total", denied)
+
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelClosed})).To(Succeed())
+		Expect(create(ctx, webhook, pipelineRun("metrics", "build")).Allowed).To(BeFalse())
+		Expect(metricValue("etcd_shield_admission_decisions_total", denied)).To(Equal(before + 1))
+	})
+
+	It("Should count denials that weren't enforced", func(ctx context.Context) {
+		resource := etcd_shield.DefaultResource
+		resource.Enforcement = etcd_shield.EnforcementAudit
+		webhook, err := etcd_shield.NewWebhook(state, etcd_shield.Config{Resources: []etcd_shield.ResourceConfig{resource}}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		audited := map[string]string{"namespace": "metrics", "outcome": etcd_shield.OutcomeDenied, "enforcement": "audit"}
+		allowed := map[string]string{"namespace": "metrics", "outcome": etcd_shield.OutcomeAllowed}
+		before := metricValue("etcd_shield_unenforced_decisions_total", audited)
+		allowedBefore := metricValue("etcd_shield_admission_decisions_total", allowed)
+
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelClosed})).To(Succeed())
+		response := webhook.Handler(resource.GroupVersionKind()).Handle(ctx, pipelineRunRequest(pipelineRun("metrics", "build")))
+		Expect(response.Allowed).To(BeTrue())
+		Expect(response.Warnings).To(BeEmpty())
+		Expect(metricValue("etcd_shield_unenforced_decisions_total", audited)).To(Equal(before + 1))
+		Expect(metricValue("etcd_shield_admission_decisions_total", allowed)).To(Equal(allowedBefore + 1))
+	})
+})
@@ -0,0 +1,273 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/common/model"
+)
+
+// MultiSource spreads queries over several endpoints, such as prometheus
+// replicas, according to its EndpointStrategy.  The health of each endpoint is
+// tracked across queries.
+type MultiSource struct {
+	strategy  EndpointStrategy
+	endpoints []*endpoint
+	lock      sync.Mutex
+}
+
+// endpoint is one of the sources behind a MultiSource.
+type endpoint struct {
+	address string
+	source  PromQuery
+	healthy bool
+}
+
+var _ PromQuery = &MultiSource{}
+
+// NewMultiSource creates a MultiSource over sources, named by the matching
+// addresses.  Every endpoint starts out healthy.
+func NewMultiSource(strategy EndpointStrategy, addresses []string, sources []PromQuery) (*MultiSource, error) {
+	if len(addresses) != len(sources) {
+		return nil, fmt.Errorf("got %d addresses for %d sources", len(addresses), len(sources))
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("at least one source is required")
+	}
+
+	m := MultiSource{strategy: strategy}
+	for i := range sources {
+		m.endpoints = append(m.endpoints, &endpoint{address: addresses[i], source: sources[i], healthy: true})
+		recordEndpointHealth(addresses[i], true)
+	}
+	return &m, nil
+}
+
+// Healthy returns the addresses of the endpoints whose last query succeeded.
+func (m *MultiSource) Healthy() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	healthy := []string{}
+	for _, e := range m.endpoints {
+		if e.healthy {
+			healthy = append(healthy, e.address)
+		}
+	}
+	return healthy
+}
+
+// quorum is how many endpoints make a majority.
+func (m *MultiSource) quorum() int {
+	return len(m.endpoints)/2 + 1
+}
+
+func (m *MultiSource) IsAlertFiring(ctx context.Context, alertName string) (bool, error) {
+	query := func(source PromQuery) (bool, error) { return source.IsAlertFiring(ctx, alertName) }
+	if m.strategy != StrategyQuorum {
+		return first(ctx, m, query)
+	}
+
+	results, err := gather(ctx, m, query)
+	if err != nil {
+		return false, err
+	}
+	firing := 0
+	for _, result := range results {
+		if result {
+			firing++
+		}
+	}
+	switch {
+	case firing >= m.quorum():
+		return true, nil
+	case len(results)-firing >= m.quorum():
+		return false, nil
+	default:
+		return false, fmt.Errorf("no quorum on whether alert %s is firing: %d of %d endpoints say it is",
+			alertName, firing, len(results))
+	}
+}
+
+func (m *MultiSource) FiringAlerts(ctx context.Context) ([]model.LabelSet, error) {
+	query := func(source PromQuery) ([]model.LabelSet, error) { return source.FiringAlerts(ctx) }
+	if m.strategy != StrategyQuorum {
+		return first(ctx, m, query)
+	}
+
+	results, err := gather(ctx, m, query)
+	if err != nil {
+		return nil, err
+	}
+	alerts := map[model.Fingerprint]model.LabelSet{}
+	counts := map[model.Fingerprint]int{}
+	for _, result := range results {
+		seen := map[model.Fingerprint]bool{}
+		for _, labels := range result {
+			fp := labels.Fingerprint()
+			if seen[fp] {
+				continue
+			}
+			seen[fp] = true
+			alerts[fp] = labels
+			counts[fp]++
+		}
+	}
+
+	firing := []model.LabelSet{}
+	for fp, count := range counts {
+		switch {
+		case count >= m.quorum():
+			firing = append(firing, alerts[fp])
+		case len(results)-count >= m.quorum():
+		default:
+			return nil, fmt.Errorf("no quorum on whether alert %s is firing: %d of %d endpoints say it is",
+				alerts[fp], count, len(results))
+		}
+	}
+	return firing, nil
+}
+
+// QueryValue returns the value from the first healthy endpoint, or with the
+// quorum strategy the median value once a majority of endpoints answered.
+func (m *MultiSource) QueryValue(ctx context.Context, q string) (float64, error) {
+	query := func(source PromQuery) (float64, error) { return source.QueryValue(ctx, q) }
+	if m.strategy != StrategyQuorum {
+		return first(ctx, m, query)
+	}
+
+	results, err := gather(ctx, m, query)
+	if err != nil {
+		return 0, err
+	}
+	sort.Float64s(results)
+	middle := len(results) / 2
+	if len(results)%2 == 0 {
+		return (results[middle-1] + results[middle]) / 2, nil
+	}
+	return results[middle], nil
+}
+
+// QueryRange returns the samples from the first healthy endpoint, or with the
+// quorum strategy the samples whose last value is the median once a majority
+// of endpoints answered.
+func (m *MultiSource) QueryRange(ctx context.Context, q string, start, end time.Time, step time.Duration) ([]model.SamplePair, error) {
+	query := func(source PromQuery) ([]model.SamplePair, error) { return source.QueryRange(ctx, q, start, end, step) }
+	if m.strategy != StrategyQuorum {
+		return first(ctx, m, query)
+	}
+
+	results, err := gather(ctx, m, query)
+	if err != nil {
+		return nil, err
+	}
+	last := func(samples []model.SamplePair) model.SampleValue {
+		if len(samples) == 0 {
+			return 0
+		}
+		return samples[len(samples)-1].Value
+	}
+	sort.Slice(results, func(i, j int) bool { return last(results[i]) < last(results[j]) })
+	return results[len(results)/2], nil
+}
+
+// order returns the endpoints with the healthy ones first, otherwise keeping
+// the configured order.
+func (m *MultiSource) order() []*endpoint {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	ordered := make([]*endpoint, 0, len(m.endpoints))
+	for _, healthy := range []bool{true, false} {
+		for _, e := range m.endpoints {
+			if e.healthy == healthy {
+				ordered = append(ordered, e)
+			}
+		}
+	}
+	return ordered
+}
+
+// record updates the health of e after a query that returned err.
+func (m *MultiSource) record(ctx context.Context, e *endpoint, err error) {
+	l := logr.FromContextOrDiscard(ctx)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	healthy := err == nil
+	if healthy != e.healthy {
+		if healthy {
+			l.Info("prometheus endpoint recovered", "address", e.address)
+		} else {
+			l.Error(err, "prometheus endpoint became unhealthy", "address", e.address)
+		}
+	}
+	e.healthy = healthy
+	recordEndpointHealth(e.address, healthy)
+}
+
+// first returns the result of the first endpoint to answer query, trying the
+// healthy endpoints before the others.
+func first[T any](ctx context.Context, m *MultiSource, query func(PromQuery) (T, error)) (T, error) {
+	var errs []error
+	for _, e := range m.order() {
+		result, err := query(e.source)
+		m.record(ctx, e, err)
+		if err == nil {
+			return result, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", e.address, err))
+	}
+
+	var zero T
+	return zero, fmt.Errorf("no prometheus endpoint answered: %w", errors.Join(errs...))
+}
+
+// gather runs query against every endpoint at once, returning the results of
+// those that answered as long as they make a majority.
+func gather[T any](ctx context.Context, m *MultiSource, query func(PromQuery) (T, error)) ([]T, error) {
+	results := make([]T, len(m.endpoints))
+	errs := make([]error, len(m.endpoints))
+	wg := sync.WaitGroup{}
+	for i, e := range m.endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = query(e.source)
+			m.record(ctx, e, errs[i])
+		}()
+	}
+	wg.Wait()
+
+	answered := []T{}
+	failed := []error{}
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Errorf("%s: %w", m.endpoints[i].address, err))
+			continue
+		}
+		answered = append(answered, results[i])
+	}
+	if len(answered) < m.quorum() {
+		return nil, fmt.Errorf("only %d of %d prometheus endpoints answered, %d needed: %w",
+			len(answered), len(m.endpoints), m.quorum(), errors.Join(failed...))
+	}
+	return answered, nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield_test
+
+import (
+	"context"
+	"errors"
+
+	etcd_shield "github.com/konflux-ci/etcd-shield/pkg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/common/model"
+)
+
+// flakyPrometheus is a fakePrometheus that fails every query while down.
+type flakyPrometheus struct {
+	fakePrometheus
+	down  bool
+	calls int
+}
+
+func (f *flakyPrometheus) IsAlertFiring(ctx context.Context, alertName string) (bool, error) {
+	f.calls++
+	if f.down {
+		return false, errors.New("connection refused")
+	}
+	return f.fakePrometheus.IsAlertFiring(ctx, alertName)
+}
+
+func (f *flakyPrometheus) FiringAlerts(ctx context.Context) ([]model.LabelSet, error) {
+	f.calls++
+	if f.down {
+		return nil, errors.New("connection refused")
+	}
+	return f.fakePrometheus.FiringAlerts(ctx)
+}
+
+func (f *flakyPrometheus) QueryValue(ctx context.Context, query string) (float64, error) {
+	f.calls++
+	if f.down {
+		return 0, errors.New("connection refused")
+	}
+	return f.fakePrometheus.QueryValue(ctx, query)
+}
+
+var _ = Describe("Pkg/MultiSource", func() {
+	var endpoints []*flakyPrometheus
+	addresses := []string{"http://prometheus-0:9090", "http://prometheus-1:9090", "http://prometheus-2:9090"}
+
+	BeforeEach(func() {
+		endpoints = nil
+		for range addresses {
+			endpoints = append(endpoints, &flakyPrometheus{fakePrometheus: fakePrometheus{firing: map[string]bool{}}})
+		}
+	})
+
+	multi := func(strategy etcd_shield.EndpointStrategy) *etcd_shield.MultiSource {
+		sources := []etcd_shield.PromQuery{}
+		for _, e := range endpoints {
+			sources = append(sources, e)
+		}
+		m, err := etcd_shield.NewMultiSource(strategy, addresses, sources)
+		Expect(err).NotTo(HaveOccurred())
+		return m
+	}
+
+	It("Should fail over to the next healthy endpoint", func(ctx context.Context) {
+		m := multi(etcd_shield.StrategyFailover)
+		endpoints[0].down = true
+		endpoints[1].value = 42
+		Expect(m.QueryValue(ctx, "up")).To(BeEquivalentTo(42))
+		Expect(m.Healthy()).To(ConsistOf(addresses[1], addresses[2]))
+
+		// the unhealthy endpoint is only tried after the healthy ones
+		Expect(m.QueryValue(ctx, "up")).To(BeEquivalentTo(42))
+		Expect(endpoints[0].calls).To(Equal(1))
+
+		endpoints[1].down = true
+		endpoints[2].down = true
+		_, err := m.QueryValue(ctx, "up")
+		Expect(err).To(MatchError(ContainSubstring("no prometheus endpoint answered")))
+
+		endpoints[0].down = false
+		endpoints[0].value = 7
+		Expect(m.QueryValue(ctx, "up")).To(BeEquivalentTo(7))
+		Expect(m.Healthy()).To(ConsistOf(addresses[0]))
+	})
+
+	It("Should need a majority to agree on alerts", func(ctx context.Context) {
+		m := multi(etcd_shield.StrategyQuorum)
+		endpoints[0].firing["deny"] = true
+		Expect(m.IsAlertFiring(ctx, "deny")).To(BeFalse())
+		Expect(m.FiringAlerts(ctx)).To(BeEmpty())
+
+		endpoints[1].firing["deny"] = true
+		Expect(m.IsAlertFiring(ctx, "deny")).To(BeTrue())
+		Expect(m.FiringAlerts(ctx)).To(ConsistOf(model.LabelSet{"alertname": "deny"}))
+
+		// one answer each way isn't a majority of three
+		endpoints[2].down = true
+		endpoints[1].firing["deny"] = false
+		_, err := m.IsAlertFiring(ctx, "deny")
+		Expect(err).To(MatchError(ContainSubstring("no quorum")))
+		_, err = m.FiringAlerts(ctx)
+		Expect(err).To(MatchError(ContainSubstring("no quorum")))
+
+		endpoints[1].down = true
+		_, err = m.IsAlertFiring(ctx, "deny")
+		Expect(err).To(MatchError(ContainSubstring("only 1 of 3")))
+	})
+
+	It("Should use the median value of a quorum", func(ctx context.Context) {
+		m := multi(etcd_shield.StrategyQuorum)
+		endpoints[0].value = 10
+		endpoints[1].value = 90
+		endpoints[2].value = 50
+		Expect(m.QueryValue(ctx, "up")).To(BeEquivalentTo(50))
+
+		endpoints[1].down = true
+		Expect(m.QueryValue(ctx, "up")).To(BeEquivalentTo(30))
+		Expect(metricValue("etcd_shield_prometheus_endpoint_up", map[string]string{"address": addresses[1]})).To(BeEquivalentTo(0))
+		Expect(metricValue("etcd_shield_prometheus_endpoint_up", map[string]string{"address": addresses[2]})).To(BeEquivalentTo(1))
+	})
+})
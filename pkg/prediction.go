@@ -0,0 +1,126 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/common/model"
+)
+
+// Keys of the projection in StateRecord.Values.
+const (
+	GROWTH_VALUE        = "growthPerSecond"
+	TIME_TO_QUOTA_VALUE = "timeToQuotaSeconds"
+	QUOTA_VALUE         = "quota"
+)
+
+// projection is where the database size is heading.
+type projection struct {
+	// growth is the fitted growth per second
+	growth float64
+	// timeToQuota is how long until the quota is reached at that rate, or
+	// +Inf if it isn't growing
+	timeToQuota float64
+}
+
+// predict fits the growth of the database size over the configured window
+// and projects how long it has until the configured quota, resolved against
+// etcd's quota.
+func predict(ctx context.Context, prometheus PromQuery, cfg *PredictionConfig, quota float64, now time.Time) (*projection, error) {
+	samples, err := prometheus.QueryRange(ctx, cfg.Query, now.Add(-cfg.Window.Duration), now, cfg.Step.Duration)
+	if err != nil {
+		return nil, err
+	}
+	growth, ok := fitGrowth(samples)
+	if !ok {
+		return nil, fmt.Errorf("need at least two samples of %q to fit growth, got %d", cfg.Query, len(samples))
+	}
+
+	limit := cfg.Quota.Resolve(quota)
+	current := float64(samples[len(samples)-1].Value)
+	p := projection{growth: growth, timeToQuota: math.Inf(1)}
+	switch {
+	case current >= limit:
+		p.timeToQuota = 0
+	case growth > 0:
+		p.timeToQuota = (limit - current) / growth
+	}
+	return &p, nil
+}
+
+// fitGrowth returns the least squares slope of samples, per second.
+func fitGrowth(samples []model.SamplePair) (float64, bool) {
+	if len(samples) < 2 {
+		return 0, false
+	}
+
+	// times are taken relative to the first sample to keep the sums small
+	origin := samples[0].Timestamp
+	var sumT, sumV, sumTT, sumTV float64
+	for _, sample := range samples {
+		t := float64(sample.Timestamp.Sub(origin)) / float64(time.Second)
+		v := float64(sample.Value)
+		sumT += t
+		sumV += v
+		sumTT += t * t
+		sumTV += t * v
+	}
+	n := float64(len(samples))
+	denominator := n*sumTT - sumT*sumT
+	if denominator == 0 {
+		return 0, false
+	}
+	return (n*sumTV - sumT*sumV) / denominator, true
+}
+
+// applyPrediction closes admission in record if the database is projected to
+// reach its quota within the horizon, and records the projection.  Failing to
+// predict leaves record as it is, since the other signals still apply.
+func (q *Querier) applyPrediction(ctx context.Context, settings *querierSettings, record *StateRecord, quota float64, now time.Time) {
+	l := logr.FromContextOrDiscard(ctx)
+	cfg := settings.config.Prediction
+	if cfg == nil {
+		return
+	}
+
+	p, err := predict(ctx, settings.prometheus, cfg, quota, now)
+	if err != nil {
+		l.Error(err, "failed to predict time to quota")
+		return
+	}
+	l.Info("growth projection", "growth-per-second", p.growth, "time-to-quota-seconds", p.timeToQuota)
+	recordProjection(p.timeToQuota)
+
+	if record.Values == nil {
+		record.Values = map[string]float64{}
+	}
+	record.Values[GROWTH_VALUE] = p.growth
+	if !math.IsInf(p.timeToQuota, 1) {
+		// infinity can't be stored as JSON, so it's left out
+		record.Values[TIME_TO_QUOTA_VALUE] = p.timeToQuota
+	}
+
+	if record.Level != LevelClosed && p.timeToQuota < cfg.Horizon.Seconds() {
+		record.Level = LevelClosed
+		record.Reason = fmt.Sprintf("projected to reach the quota in %s, within the horizon of %s",
+			time.Duration(p.timeToQuota*float64(time.Second)).Round(time.Second), cfg.Horizon.Duration)
+		record.Signal = cfg.Query
+	}
+}
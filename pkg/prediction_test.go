@@ -0,0 +1,107 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield_test
+
+import (
+	"context"
+	"math"
+	"time"
+
+	etcd_shield "github.com/konflux-ci/etcd-shield/pkg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/common/model"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// growingSeries returns samples every 30s over the last 10m, starting at
+// start and growing by perSecond.
+func growingSeries(start, perSecond float64) []model.SamplePair {
+	now := time.Now()
+	samples := []model.SamplePair{}
+	for t := -600; t <= 0; t += 30 {
+		samples = append(samples, model.SamplePair{
+			Timestamp: model.TimeFromUnixNano(now.Add(time.Duration(t) * time.Second).UnixNano()),
+			Value:     model.SampleValue(start + perSecond*float64(t+600)),
+		})
+	}
+	return samples
+}
+
+var _ = Describe("Pkg/Prediction", func() {
+	var prom *fakePrometheus
+	var state etcd_shield.StateManager
+	var querier *etcd_shield.Querier
+
+	BeforeEach(func() {
+		prom = &fakePrometheus{firing: map[string]bool{}}
+		state = etcd_shield.NewState(fake.NewClientBuilder().Build(), types.NamespacedName{Name: "state", Namespace: "etcd-shield"})
+		cfg := etcd_shield.Config{
+			Prometheus: etcd_shield.PrometheusConfig{AlertName: "deny"},
+			Prediction: &etcd_shield.PredictionConfig{
+				Query:   "max(etcd_mvcc_db_total_size_in_bytes)",
+				Quota:   etcd_shield.NewThreshold(8000),
+				Horizon: etcd_shield.NewDuration(30 * time.Minute),
+			},
+		}
+		cfg.Default()
+		querier = etcd_shield.NewQuerier(prom, state, cfg)
+	})
+
+	It("Should stay open while growth is slow", func(ctx context.Context) {
+		// 5000 to 5600 over 10m, so 40m left
+		prom.series = growingSeries(5000, 1)
+		Expect(querier.Process(ctx)).To(Succeed())
+
+		record, err := state.ReadConfig(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(record.Level).To(Equal(etcd_shield.LevelOpen))
+		Expect(record.Values).To(HaveKeyWithValue(etcd_shield.GROWTH_VALUE, BeNumerically("~", 1, 1e-6)))
+		Expect(record.Values).To(HaveKeyWithValue(etcd_shield.TIME_TO_QUOTA_VALUE, BeNumerically("~", 2400, 1e-3)))
+		Expect(metricValue("etcd_shield_predicted_time_to_quota_seconds", nil)).To(BeNumerically("~", 2400, 1e-3))
+	})
+
+	It("Should close admission when the quota is projected within the horizon", func(ctx context.Context) {
+		// 5000 to 6800 over 10m, so 400s left
+		prom.series = growingSeries(5000, 3)
+		Expect(querier.Process(ctx)).To(Succeed())
+
+		record, err := state.ReadConfig(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(record.Level).To(Equal(etcd_shield.LevelClosed))
+		Expect(record.Signal).To(Equal("max(etcd_mvcc_db_total_size_in_bytes)"))
+		Expect(record.Reason).To(Equal("projected to reach the quota in 6m40s, within the horizon of 30m0s"))
+	})
+
+	It("Should not project anything while the database shrinks", func(ctx context.Context) {
+		prom.series = growingSeries(7000, -1)
+		Expect(querier.Process(ctx)).To(Succeed())
+
+		record, err := state.ReadConfig(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(record.Level).To(Equal(etcd_shield.LevelOpen))
+		Expect(record.Values).NotTo(HaveKey(etcd_shield.TIME_TO_QUOTA_VALUE))
+		Expect(math.IsInf(metricValue("etcd_shield_predicted_time_to_quota_seconds", nil), 1)).To(BeTrue())
+	})
+
+	It("Should fall back to the other signals without enough samples", func(ctx context.Context) {
+		prom.series = growingSeries(5000, 3)[:1]
+		prom.firing["deny"] = true
+		Expect(querier.Process(ctx)).To(Succeed())
+		Expect(state.ReadConfig(ctx)).To(HaveField("Level", etcd_shield.LevelClosed))
+		Expect(state.ReadConfig(ctx)).To(HaveField("Reason", "alert deny is firing"))
+	})
+})
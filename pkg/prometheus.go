@@ -16,6 +16,7 @@ package etcd_shield
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -27,6 +28,11 @@ import (
 
 type PromQuery interface {
 	IsAlertFiring(context.Context, string) (bool, error)
+	// FiringAlerts returns the labels of every firing alert.
+	FiringAlerts(context.Context) ([]model.LabelSet, error)
+	QueryValue(context.Context, string) (float64, error)
+	// QueryRange returns the samples of query between start and end.
+	QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration) ([]model.SamplePair, error)
 }
 
 type Prometheus struct {
@@ -35,6 +41,79 @@ type Prometheus struct {
 
 var _ PromQuery = &Prometheus{}
 
+// NewSource creates the PromQuery described by cfg.  When etcdStatus is set
+// alongside another source, the PromQuery is also an AlarmSource.
+func NewSource(cfg Config) (PromQuery, error) {
+	if cfg.Source == SourceEtcdStatus {
+		if cfg.EtcdStatus == nil {
+			return nil, fmt.Errorf("etcdStatus must be set to use the etcdStatus source")
+		}
+		return NewEtcdStatus(cfg.EtcdStatus.Endpoints, cfg.EtcdStatus.TLS)
+	}
+
+	source, err := newSignalSource(cfg)
+	if err != nil || cfg.EtcdStatus == nil {
+		return source, err
+	}
+	status, err := NewEtcdStatus(cfg.EtcdStatus.Endpoints, cfg.EtcdStatus.TLS)
+	if err != nil {
+		return nil, err
+	}
+	return &withAlarms{PromQuery: source, EtcdStatus: status}, nil
+}
+
+// withAlarms pairs a PromQuery with the alarms of an etcd cluster.
+type withAlarms struct {
+	PromQuery
+	*EtcdStatus
+}
+
+func (w *withAlarms) IsAlertFiring(ctx context.Context, alertName string) (bool, error) {
+	return w.PromQuery.IsAlertFiring(ctx, alertName)
+}
+
+func (w *withAlarms) FiringAlerts(ctx context.Context) ([]model.LabelSet, error) {
+	return w.PromQuery.FiringAlerts(ctx)
+}
+
+func (w *withAlarms) QueryValue(ctx context.Context, query string) (float64, error) {
+	return w.PromQuery.QueryValue(ctx, query)
+}
+
+func (w *withAlarms) QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration) ([]model.SamplePair, error) {
+	return w.PromQuery.QueryRange(ctx, query, start, end, step)
+}
+
+func newSignalSource(cfg Config) (PromQuery, error) {
+	switch cfg.Source {
+	case SourceEtcdMetrics:
+		if cfg.EtcdMetrics == nil {
+			return nil, fmt.Errorf("etcdMetrics must be set to use the etcdMetrics source")
+		}
+		return NewEtcdMetrics(cfg.EtcdMetrics.Endpoints, cfg.EtcdMetrics.Config)
+	case SourceAlertmanager:
+		if cfg.Alertmanager == nil {
+			return nil, fmt.Errorf("alertmanager must be set to use the alertmanager source")
+		}
+		return NewAlertmanager(cfg.Alertmanager.Address, cfg.Alertmanager.Matchers, cfg.Alertmanager.Config)
+	case SourcePrometheus, "":
+		if len(cfg.Prometheus.Addresses) == 0 {
+			return NewPrometheus(cfg.Prometheus.Address, cfg.Prometheus.Config)
+		}
+		sources := make([]PromQuery, 0, len(cfg.Prometheus.Addresses))
+		for _, address := range cfg.Prometheus.Addresses {
+			source, err := NewPrometheus(address, cfg.Prometheus.Config)
+			if err != nil {
+				return nil, err
+			}
+			sources = append(sources, source)
+		}
+		return NewMultiSource(cfg.Prometheus.Strategy, cfg.Prometheus.Addresses, sources)
+	default:
+		return nil, fmt.Errorf("unknown source %q", cfg.Source)
+	}
+}
+
 func NewPrometheus(address string, cfg config.HTTPClientConfig) (PromQuery, error) {
 	httpClient, err := config.NewClientFromConfig(cfg, "prometheus")
 	if err != nil {
@@ -56,7 +135,9 @@ func (p *Prometheus) IsAlertFiring(ctx context.Context, alertName string) (bool,
 	log := logr.FromContextOrDiscard(ctx)
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
+	start := time.Now()
 	alerts, err := p.prometheus.Alerts(ctx)
+	recordQuery("alerts", start, err)
 	if err != nil {
 		log.Error(err, "Error querying prometheus for active alerts")
 		return false, err
@@ -70,3 +151,97 @@ func (p *Prometheus) IsAlertFiring(ctx context.Context, alertName string) (bool,
 
 	return false, nil
 }
+
+// FiringAlerts returns the labels of every firing alert.
+func (p *Prometheus) FiringAlerts(ctx context.Context) ([]model.LabelSet, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	alerts, err := p.prometheus.Alerts(ctx)
+	recordQuery("alerts", start, err)
+	if err != nil {
+		log.Error(err, "Error querying prometheus for active alerts")
+		return nil, err
+	}
+
+	firing := []model.LabelSet{}
+	for _, alert := range alerts.Alerts {
+		if alert.State == v1.AlertStateFiring {
+			firing = append(firing, alert.Labels)
+		}
+	}
+	return firing, nil
+}
+
+// QueryValue runs an instant query and returns its value.  If the query returns
+// a vector, the largest sample is used.
+func (p *Prometheus) QueryValue(ctx context.Context, query string) (float64, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	result, warnings, err := p.prometheus.Query(ctx, query, start)
+	recordQuery("instant", start, err)
+	if err != nil {
+		log.Error(err, "Error running prometheus query", "query", query)
+		return 0, err
+	}
+	if len(warnings) > 0 {
+		log.Info("Prometheus query returned warnings", "query", query, "warnings", warnings)
+	}
+
+	switch value := result.(type) {
+	case *model.Scalar:
+		return float64(value.Value), nil
+	case model.Vector:
+		if len(value) == 0 {
+			return 0, fmt.Errorf("query %q returned no samples", query)
+		}
+		largest := value[0].Value
+		for _, sample := range value[1:] {
+			if sample.Value > largest {
+				largest = sample.Value
+			}
+		}
+		return float64(largest), nil
+	default:
+		return 0, fmt.Errorf("query %q returned unsupported result type %s", query, result.Type())
+	}
+}
+
+// QueryRange runs a range query and returns its samples.  If the query returns
+// several series, the one with the largest last sample is used.
+func (p *Prometheus) QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration) ([]model.SamplePair, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	began := time.Now()
+	result, warnings, err := p.prometheus.QueryRange(ctx, query, v1.Range{Start: start, End: end, Step: step})
+	recordQuery("range", began, err)
+	if err != nil {
+		log.Error(err, "Error running prometheus range query", "query", query)
+		return nil, err
+	}
+	if len(warnings) > 0 {
+		log.Info("Prometheus range query returned warnings", "query", query, "warnings", warnings)
+	}
+
+	matrix, ok := result.(model.Matrix)
+	if !ok {
+		return nil, fmt.Errorf("range query %q returned unsupported result type %s", query, result.Type())
+	}
+	var largest []model.SamplePair
+	for _, series := range matrix {
+		if len(series.Values) == 0 {
+			continue
+		}
+		if largest == nil || series.Values[len(series.Values)-1].Value > largest[len(largest)-1].Value {
+			largest = series.Values
+		}
+	}
+	if largest == nil {
+		return nil, fmt.Errorf("range query %q returned no samples", query)
+	}
+	return largest, nil
+}
@@ -16,67 +16,465 @@ package etcd_shield
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
 type Querier struct {
-	state      StateManager
+	state    StateManager
+	settings atomic.Pointer[querierSettings]
+
+	// trigger asks Start to process the state before the next tick
+	trigger chan struct{}
+	running atomic.Bool
+}
+
+// querierSettings is everything the Querier swaps out when the config is
+// reloaded.
+type querierSettings struct {
 	prometheus PromQuery
 	config     Config
 }
 
 func NewQuerier(prom PromQuery, state StateManager, config Config) *Querier {
 	querier := Querier{
+		state:   state,
+		trigger: make(chan struct{}, 1),
+	}
+	querier.settings.Store(&querierSettings{
 		prometheus: prom,
-		state:      state,
 		config:     config,
-	}
+	})
 
 	return &querier
 }
 
 var _ manager.Runnable = &Querier{}
 var _ manager.LeaderElectionRunnable = &Querier{}
+var _ Reloader = &Querier{}
+
+// PrepareReload swaps in cfg once committed.  The signal source is only
+// rebuilt if cfg changes how it's reached, so endpoint health and connections
+// carry over otherwise.
+func (q *Querier) PrepareReload(cfg *Config) (func(), func(), error) {
+	current := q.settings.Load()
+	if !sourceChanged(&current.config, cfg) {
+		return func() {
+			q.settings.Store(&querierSettings{
+				prometheus: q.settings.Load().prometheus,
+				config:     *cfg,
+			})
+		}, nil, nil
+	}
+
+	prom, err := NewSource(*cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to setup prometheus connection: %w", err)
+	}
+
+	settings := &querierSettings{
+		prometheus: prom,
+		config:     *cfg,
+	}
+	commit := func() {
+		old := q.settings.Swap(settings)
+		closeSource(old.prometheus)
+	}
+	abort := func() {
+		closeSource(prom)
+	}
+	return commit, abort, nil
+}
+
+// sourceChanged indicates whether the signal source has to be rebuilt to go
+// from old to cfg.
+func sourceChanged(old, cfg *Config) bool {
+	return old.Source != cfg.Source ||
+		old.Prometheus.Address != cfg.Prometheus.Address ||
+		!reflect.DeepEqual(old.Prometheus.Addresses, cfg.Prometheus.Addresses) ||
+		old.Prometheus.Strategy != cfg.Prometheus.Strategy ||
+		!reflect.DeepEqual(old.Prometheus.Config, cfg.Prometheus.Config) ||
+		!reflect.DeepEqual(old.EtcdMetrics, cfg.EtcdMetrics) ||
+		!reflect.DeepEqual(old.EtcdStatus, cfg.EtcdStatus) ||
+		!reflect.DeepEqual(old.Alertmanager, cfg.Alertmanager)
+}
+
+// closeSource disconnects prom if it holds connections.
+func closeSource(prom PromQuery) {
+	if closer, ok := prom.(io.Closer); ok {
+		_ = closer.Close()
+	}
+}
 
 func (q *Querier) NeedLeaderElection() bool {
 	// for now, only one reader/writer to prometheus
 	return true
 }
 
+// Trigger asks the running querier to process the state now rather than on
+// its next tick.  It returns false if the querier isn't running here, such as
+// when another replica is the leader.
+func (q *Querier) Trigger() bool {
+	if !q.running.Load() {
+		return false
+	}
+	select {
+	case q.trigger <- struct{}{}:
+	default:
+		// already triggered and not yet processed
+	}
+	return true
+}
+
 func (q *Querier) Start(ctx context.Context) error {
 	l := logr.FromContextOrDiscard(ctx)
-	ticker := time.NewTicker(q.config.WaitTime.Duration)
+	waitTime := q.settings.Load().config.WaitTime.Duration
+	ticker := time.NewTicker(waitTime)
+	defer ticker.Stop()
+	q.running.Store(true)
+	defer q.running.Store(false)
 	for {
 		select {
+		case <-q.trigger:
+			err := q.process(ctx, true)
+			if err != nil {
+				l.Error(err, "failed to process triggered state")
+			}
 		case <-ticker.C:
 			err := q.Process(ctx)
 			if err != nil {
 				l.Error(err, "failed to process state")
 			}
+			if reloaded := q.settings.Load().config.WaitTime.Duration; reloaded != waitTime {
+				waitTime = reloaded
+				ticker.Reset(waitTime)
+			}
 		case <-ctx.Done():
 			return nil
 		}
 	}
 }
 
+// Process checks the signals and writes the admission level they ask for,
+// counting as one of damping's observations.
 func (q *Querier) Process(ctx context.Context) error {
+	return q.process(ctx, false)
+}
+
+// process is Process, for a check triggered between ticks if triggered.
+func (q *Querier) process(ctx context.Context, triggered bool) error {
 	l := logr.FromContextOrDiscard(ctx)
 
-	// step 1: check if the alert we're interested in is firing
-	firing, err := q.prometheus.IsAlertFiring(ctx, q.config.Prometheus.AlertName)
+	current, err := q.state.ReadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	// step 1: determine how much ingress we should allow
+	settings := q.settings.Load()
+	var quota float64
+	var quotaErr error
+	if settings.config.levelsUseQuota() {
+		quota, err = discoverQuota(ctx, settings.prometheus, settings.config.Quota)
+		if err != nil {
+			return err
+		}
+	} else if settings.config.usesQuota() {
+		// only the prediction needs the quota, so failing to discover it only
+		// fails the prediction
+		quota, quotaErr = discoverQuota(ctx, settings.prometheus, settings.config.Quota)
+	}
+	record, err := q.evaluate(ctx, settings, current, quota)
 	if err != nil {
 		return err
 	}
-	l.Info("pipelinerun ingress status", "is-firing", firing)
+	now := metav1.Now()
+	if quotaErr != nil {
+		l.Error(quotaErr, "failed to predict time to quota")
+	} else {
+		q.applyPrediction(ctx, settings, record, quota, now.Time)
+	}
+	damp(settings.config.Damping, current, record, now.Time, triggered)
+	record.Ramp = nextRamp(settings.config.Ramp, current, record, now.Time)
+	if quota > 0 {
+		if record.Values == nil {
+			record.Values = map[string]float64{}
+		}
+		record.Values[QUOTA_VALUE] = quota
+	}
+	l.Info("pipelinerun ingress status", "level", record.Level, "reason", record.Reason)
+
+	record.LastCheckTime = now
+	if record.Level != current.Level || current.LastTransitionTime.IsZero() {
+		record.LastTransitionTime = now
+	} else {
+		record.LastTransitionTime = current.LastTransitionTime
+	}
 
 	// step 2: update the webhooks
-	err = q.state.WriteConfig(ctx, !firing)
+	err = q.state.WriteConfig(ctx, record)
 	if err != nil {
 		return err
 	}
+	recordLevel(current.Level, record.Level)
 
 	return nil
 }
+
+// evaluate determines the admission level, either from the configured alerts
+// or from the configured query and its thresholds.  Configured etcd alarms
+// close admission before either is checked.  The thresholds latch on the level
+// they latched at in current, rather than on current's level.
+func (q *Querier) evaluate(ctx context.Context, settings *querierSettings, current *StateRecord, quota float64) (*StateRecord, error) {
+	l := logr.FromContextOrDiscard(ctx)
+	prometheus := settings.prometheus
+	cfg := settings.config.Prometheus
+	throttle := settings.config.Throttle
+
+	if record, err := q.evaluateAlarms(ctx, settings); record != nil || err != nil {
+		if record != nil {
+			// the query isn't checked, so its latch carries over
+			record.Latched = current.Latched
+		}
+		return record, err
+	}
+	if cfg.Alerts != nil {
+		return q.evaluateSelectors(ctx, prometheus, cfg.Alerts)
+	}
+
+	if cfg.Query == "" {
+		values := map[string]float64{}
+		firing, err := prometheus.IsAlertFiring(ctx, cfg.AlertName)
+		if err != nil {
+			return nil, err
+		}
+		l.Info("alert status", "alert", cfg.AlertName, "is-firing", firing)
+		values[cfg.AlertName] = boolValue(firing)
+		if firing {
+			return &StateRecord{
+				Level:  LevelClosed,
+				Reason: fmt.Sprintf("alert %s is firing", cfg.AlertName),
+				Signal: cfg.AlertName,
+				Values: values,
+			}, nil
+		}
+
+		if throttle == nil || throttle.AlertName == "" {
+			return &StateRecord{
+				Level:  LevelOpen,
+				Reason: fmt.Sprintf("alert %s is not firing", cfg.AlertName),
+				Signal: cfg.AlertName,
+				Values: values,
+			}, nil
+		}
+		firing, err = prometheus.IsAlertFiring(ctx, throttle.AlertName)
+		if err != nil {
+			return nil, err
+		}
+		l.Info("alert status", "alert", throttle.AlertName, "is-firing", firing)
+		values[throttle.AlertName] = boolValue(firing)
+		if firing {
+			return &StateRecord{
+				Level:  LevelThrottled,
+				Reason: fmt.Sprintf("alert %s is firing", throttle.AlertName),
+				Signal: throttle.AlertName,
+				Values: values,
+			}, nil
+		}
+		return &StateRecord{
+			Level:  LevelOpen,
+			Reason: fmt.Sprintf("alerts %s and %s are not firing", cfg.AlertName, throttle.AlertName),
+			Signal: cfg.AlertName,
+			Values: values,
+		}, nil
+	}
+
+	value, err := prometheus.QueryValue(ctx, cfg.Query)
+	if err != nil {
+		return nil, err
+	}
+	latched := current.Latched
+	if latched == "" {
+		// records written before Latched existed only have their level
+		latched = current.Level
+	}
+	l.Info("query status", "value", value, "latched", latched)
+
+	record := StateRecord{
+		Signal: cfg.Query,
+		Values: map[string]float64{"query": value},
+	}
+	set, reset := cfg.SetThreshold.Resolve(quota), cfg.ResetThreshold.Resolve(quota)
+	switch {
+	case latch(latched == LevelClosed, value, set, reset):
+		record.Level = LevelClosed
+		record.Reason = thresholdReason(value, set, reset)
+	case throttle != nil && latch(latched != LevelOpen, value, throttle.SetThreshold.Resolve(quota), throttle.ResetThreshold.Resolve(quota)):
+		record.Level = LevelThrottled
+		record.Reason = thresholdReason(value, throttle.SetThreshold.Resolve(quota), throttle.ResetThreshold.Resolve(quota))
+	default:
+		record.Level = LevelOpen
+		record.Reason = fmt.Sprintf("query value %g is below the thresholds", value)
+	}
+	record.Latched = record.Level
+	return &record, nil
+}
+
+// evaluateAlarms closes admission if any of the configured etcd alarms is
+// active.  A nil record means none are.
+func (q *Querier) evaluateAlarms(ctx context.Context, settings *querierSettings) (*StateRecord, error) {
+	l := logr.FromContextOrDiscard(ctx)
+	source, ok := settings.prometheus.(AlarmSource)
+	if !ok || settings.config.EtcdStatus == nil || len(settings.config.EtcdStatus.Alarms) == 0 {
+		return nil, nil
+	}
+
+	active, err := source.ActiveAlarms(ctx)
+	if err != nil {
+		return nil, err
+	}
+	l.Info("etcd alarms", "active", active)
+	for _, alarm := range settings.config.EtcdStatus.Alarms {
+		for _, a := range active {
+			if a == alarm {
+				return &StateRecord{
+					Level:  LevelClosed,
+					Reason: fmt.Sprintf("etcd alarm %s is active", alarm),
+					Signal: alarm,
+					Values: map[string]float64{alarm: 1},
+				}, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// evaluateSelectors picks the most restrictive level whose selectors match the
+// firing alerts, combining the selectors of each level as configured.
+func (q *Querier) evaluateSelectors(ctx context.Context, prometheus PromQuery, alerts *AlertSelectors) (*StateRecord, error) {
+	l := logr.FromContextOrDiscard(ctx)
+	firing, err := prometheus.FiringAlerts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]float64{}
+	selectors := map[Level]int{}
+	matched := map[Level][]string{}
+	for _, selector := range alerts.Selectors {
+		matchers, err := ParseMatchers(selector.Matchers)
+		if err != nil {
+			return nil, err
+		}
+		name := selectorName(matchers)
+		level := selector.Level
+		if level == "" {
+			level = LevelClosed
+		}
+
+		match := false
+		for _, labels := range firing {
+			if matchesAll(matchers, labels) {
+				match = true
+				break
+			}
+		}
+		l.Info("alert selector status", "selector", name, "is-firing", match)
+		values[name] = boolValue(match)
+		selectors[level]++
+		if match {
+			matched[level] = append(matched[level], name)
+		}
+	}
+
+	for _, level := range []Level{LevelClosed, LevelThrottled} {
+		if len(matched[level]) == 0 {
+			continue
+		}
+		if alerts.Match == AlertMatchAll && len(matched[level]) < selectors[level] {
+			continue
+		}
+		return &StateRecord{
+			Level:  level,
+			Reason: fmt.Sprintf("alerts %s are firing", strings.Join(matched[level], ", ")),
+			Signal: strings.Join(matched[level], ", "),
+			Values: values,
+		}, nil
+	}
+	return &StateRecord{
+		Level:  LevelOpen,
+		Reason: "no selected alerts are firing",
+		Values: values,
+	}, nil
+}
+
+// selectorName describes the matchers the way PromQL would.
+func selectorName(matchers []*LabelMatcher) string {
+	parts := make([]string, 0, len(matchers))
+	for _, m := range matchers {
+		parts = append(parts, m.String())
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// discoverQuota returns etcd's quota from the configured query, falling back to
+// the configured quota if that fails.
+func discoverQuota(ctx context.Context, prometheus PromQuery, cfg QuotaConfig) (float64, error) {
+	l := logr.FromContextOrDiscard(ctx)
+	if cfg.Query != "" {
+		quota, err := prometheus.QueryValue(ctx, cfg.Query)
+		if err == nil && quota <= 0 {
+			err = fmt.Errorf("quota query %q returned %g", cfg.Query, quota)
+		}
+		if err == nil {
+			return quota, nil
+		}
+		if cfg.Fallback == nil {
+			return 0, fmt.Errorf("failed to discover the etcd quota: %w", err)
+		}
+		l.Error(err, "failed to discover the etcd quota, using the fallback", "fallback", cfg.Fallback.String())
+	}
+	if cfg.Fallback == nil {
+		return 0, fmt.Errorf("no quota query or fallback is configured")
+	}
+	return cfg.Fallback.AsApproximateFloat64(), nil
+}
+
+// thresholdReason explains why a latch with the given thresholds is set.
+func thresholdReason(value, set, reset float64) string {
+	if value >= set {
+		return fmt.Sprintf("query value %g reached the set threshold of %g", value, set)
+	}
+	return fmt.Sprintf("query value %g has not dropped below the reset threshold of %g", value, reset)
+}
+
+// boolValue converts a boolean to an observed value.
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// latch implements the set/reset hysteresis described in the README.  It
+// reports whether the latch is set: it becomes set once value reaches set, and
+// is only cleared once value drops below reset.  In between, the current state
+// is kept.
+func latch(current bool, value, set, reset float64) bool {
+	switch {
+	case value >= set:
+		return true
+	case value < reset:
+		return false
+	default:
+		return current
+	}
+}
@@ -0,0 +1,511 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	etcd_shield "github.com/konflux-ci/etcd-shield/pkg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/common/model"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type fakePrometheus struct {
+	firing map[string]bool
+	alerts []model.LabelSet
+	value  float64
+	series []model.SamplePair
+	// queries overrides value for particular queries
+	queries map[string]float64
+	// failing makes particular queries fail
+	failing map[string]bool
+}
+
+func (f *fakePrometheus) IsAlertFiring(_ context.Context, alertName string) (bool, error) {
+	return f.firing[alertName], nil
+}
+
+func (f *fakePrometheus) FiringAlerts(context.Context) ([]model.LabelSet, error) {
+	alerts := append([]model.LabelSet{}, f.alerts...)
+	for name, firing := range f.firing {
+		if firing {
+			alerts = append(alerts, model.LabelSet{model.AlertNameLabel: model.LabelValue(name)})
+		}
+	}
+	return alerts, nil
+}
+
+func (f *fakePrometheus) QueryValue(_ context.Context, query string) (float64, error) {
+	if f.failing[query] {
+		return 0, errors.New("query failed")
+	}
+	if value, ok := f.queries[query]; ok {
+		return value, nil
+	}
+	return f.value, nil
+}
+
+func (f *fakePrometheus) QueryRange(context.Context, string, time.Time, time.Time, time.Duration) ([]model.SamplePair, error) {
+	return f.series, nil
+}
+
+// countingState counts the records written to it.
+type countingState struct {
+	etcd_shield.StateManager
+	writes atomic.Int32
+}
+
+func (s *countingState) WriteConfig(ctx context.Context, record *etcd_shield.StateRecord) error {
+	defer s.writes.Add(1)
+	return s.StateManager.WriteConfig(ctx, record)
+}
+
+var _ = Describe("Pkg/Querier", func() {
+	var prom *fakePrometheus
+	var state etcd_shield.StateManager
+
+	BeforeEach(func() {
+		prom = &fakePrometheus{firing: map[string]bool{}}
+		state = etcd_shield.NewState(fake.NewClientBuilder().Build(), types.NamespacedName{Name: "state", Namespace: "etcd-shield"})
+	})
+
+	It("Should pick the level from the firing alerts", func(ctx context.Context) {
+		querier := etcd_shield.NewQuerier(prom, state, etcd_shield.Config{
+			Prometheus: etcd_shield.PrometheusConfig{AlertName: "deny"},
+			Throttle:   &etcd_shield.ThrottleConfig{AlertName: "throttle"},
+		})
+
+		steps := []struct {
+			deny, throttle bool
+			level          etcd_shield.Level
+		}{
+			{false, false, etcd_shield.LevelOpen},
+			{false, true, etcd_shield.LevelThrottled},
+			{true, true, etcd_shield.LevelClosed},
+			{true, false, etcd_shield.LevelClosed},
+			{false, false, etcd_shield.LevelOpen},
+		}
+		for _, step := range steps {
+			prom.firing["deny"] = step.deny
+			prom.firing["throttle"] = step.throttle
+			Expect(querier.Process(ctx)).To(Succeed())
+			Expect(state.ReadConfig(ctx)).To(HaveField("Level", step.level), "deny %v, throttle %v", step.deny, step.throttle)
+		}
+	})
+
+	It("Should apply set/reset hysteresis to query thresholds", func(ctx context.Context) {
+		querier := etcd_shield.NewQuerier(prom, state, etcd_shield.Config{
+			Prometheus: etcd_shield.PrometheusConfig{
+				Query:          "max(etcd_mvcc_db_total_size_in_bytes)",
+				SetThreshold:   etcd_shield.NewThreshold(95),
+				ResetThreshold: etcd_shield.NewThreshold(80),
+			},
+		})
+
+		steps := []struct {
+			value float64
+			level etcd_shield.Level
+		}{
+			{50, etcd_shield.LevelOpen},
+			{90, etcd_shield.LevelOpen},
+			{95, etcd_shield.LevelClosed},
+			{90, etcd_shield.LevelClosed},
+			{80, etcd_shield.LevelClosed},
+			{79, etcd_shield.LevelOpen},
+			{90, etcd_shield.LevelOpen},
+		}
+		for _, step := range steps {
+			prom.value = step.value
+			Expect(querier.Process(ctx)).To(Succeed())
+			Expect(state.ReadConfig(ctx)).To(HaveField("Level", step.level), "value %v", step.value)
+		}
+	})
+
+	It("Should reopen once a prediction stops closing admission below the set threshold", func(ctx context.Context) {
+		cfg := etcd_shield.Config{
+			Prometheus: etcd_shield.PrometheusConfig{
+				Query:          "max(etcd_mvcc_db_total_size_in_bytes)",
+				SetThreshold:   etcd_shield.NewThreshold(95),
+				ResetThreshold: etcd_shield.NewThreshold(80),
+			},
+			Prediction: &etcd_shield.PredictionConfig{
+				Query:   "max(etcd_mvcc_db_total_size_in_bytes)",
+				Quota:   etcd_shield.NewThreshold(100),
+				Horizon: etcd_shield.NewDuration(30 * time.Minute),
+			},
+		}
+		cfg.Default()
+		querier := etcd_shield.NewQuerier(prom, state, cfg)
+		prom.value = 85
+
+		// 25 to 85 over 10m, so 150s left
+		prom.series = growingSeries(25, 0.1)
+		Expect(querier.Process(ctx)).To(Succeed())
+		record, err := state.ReadConfig(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(record.Level).To(Equal(etcd_shield.LevelClosed))
+		Expect(record.Latched).To(Equal(etcd_shield.LevelOpen))
+
+		// growth stops between the reset and set thresholds
+		prom.series = growingSeries(85, 0)
+		Expect(querier.Process(ctx)).To(Succeed())
+		record, err = state.ReadConfig(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(record.Level).To(Equal(etcd_shield.LevelOpen))
+		Expect(record.Reason).To(Equal("query value 85 is below the thresholds"))
+	})
+
+	It("Should apply hysteresis to each level's thresholds", func(ctx context.Context) {
+		querier := etcd_shield.NewQuerier(prom, state, etcd_shield.Config{
+			Prometheus: etcd_shield.PrometheusConfig{
+				Query:          "max(etcd_mvcc_db_total_size_in_bytes)",
+				SetThreshold:   etcd_shield.NewThreshold(95),
+				ResetThreshold: etcd_shield.NewThreshold(85),
+			},
+			Throttle: &etcd_shield.ThrottleConfig{
+				SetThreshold:   etcd_shield.NewThreshold(80),
+				ResetThreshold: etcd_shield.NewThreshold(70),
+			},
+		})
+
+		steps := []struct {
+			value float64
+			level etcd_shield.Level
+		}{
+			{50, etcd_shield.LevelOpen},
+			{75, etcd_shield.LevelOpen},
+			{80, etcd_shield.LevelThrottled},
+			{75, etcd_shield.LevelThrottled},
+			{95, etcd_shield.LevelClosed},
+			{85, etcd_shield.LevelClosed},
+			{84, etcd_shield.LevelThrottled},
+			{69, etcd_shield.LevelOpen},
+		}
+		for _, step := range steps {
+			prom.value = step.value
+			Expect(querier.Process(ctx)).To(Succeed())
+			Expect(state.ReadConfig(ctx)).To(HaveField("Level", step.level), "value %v", step.value)
+		}
+	})
+
+	It("Should record why and when the level changed", func(ctx context.Context) {
+		querier := etcd_shield.NewQuerier(prom, state, etcd_shield.Config{
+			Prometheus: etcd_shield.PrometheusConfig{
+				Query:          "max(etcd_mvcc_db_total_size_in_bytes)",
+				SetThreshold:   etcd_shield.NewThreshold(95),
+				ResetThreshold: etcd_shield.NewThreshold(80),
+			},
+		})
+
+		prom.value = 96
+		Expect(querier.Process(ctx)).To(Succeed())
+		closed, err := state.ReadConfig(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(closed.Level).To(Equal(etcd_shield.LevelClosed))
+		Expect(closed.Signal).To(Equal("max(etcd_mvcc_db_total_size_in_bytes)"))
+		Expect(closed.Reason).To(ContainSubstring("set threshold"))
+		Expect(closed.Values).To(HaveKeyWithValue("query", 96.0))
+		Expect(closed.LastTransitionTime.IsZero()).To(BeFalse())
+		Expect(closed.LastCheckTime.IsZero()).To(BeFalse())
+
+		prom.value = 90
+		Expect(querier.Process(ctx)).To(Succeed())
+		stillClosed, err := state.ReadConfig(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stillClosed.Level).To(Equal(etcd_shield.LevelClosed))
+		Expect(stillClosed.Reason).To(ContainSubstring("reset threshold"))
+		Expect(stillClosed.LastTransitionTime).To(Equal(closed.LastTransitionTime))
+	})
+
+	It("Should select alerts by their labels", func(ctx context.Context) {
+		querier := etcd_shield.NewQuerier(prom, state, etcd_shield.Config{
+			Prometheus: etcd_shield.PrometheusConfig{
+				Alerts: &etcd_shield.AlertSelectors{
+					Selectors: []etcd_shield.AlertSelector{
+						{Matchers: []string{`alertname="EtcdDBSizeHigh"`, `cluster="stone-prd-1"`}},
+						{Matchers: []string{`alertname="EtcdNoSpaceAlarm"`}},
+						{Matchers: []string{`alertname="EtcdDBSizeWarning"`}, Level: etcd_shield.LevelThrottled},
+					},
+				},
+			},
+			Throttle: &etcd_shield.ThrottleConfig{Fraction: 0.5},
+		})
+
+		steps := []struct {
+			alerts []model.LabelSet
+			level  etcd_shield.Level
+		}{
+			{nil, etcd_shield.LevelOpen},
+			{[]model.LabelSet{{"alertname": "EtcdDBSizeHigh", "cluster": "stone-prd-2"}}, etcd_shield.LevelOpen},
+			{[]model.LabelSet{{"alertname": "EtcdDBSizeWarning"}}, etcd_shield.LevelThrottled},
+			{[]model.LabelSet{{"alertname": "EtcdDBSizeHigh", "cluster": "stone-prd-1"}}, etcd_shield.LevelClosed},
+			{[]model.LabelSet{{"alertname": "EtcdNoSpaceAlarm"}, {"alertname": "EtcdDBSizeWarning"}}, etcd_shield.LevelClosed},
+		}
+		for _, step := range steps {
+			prom.alerts = step.alerts
+			Expect(querier.Process(ctx)).To(Succeed())
+			Expect(state.ReadConfig(ctx)).To(HaveField("Level", step.level), "alerts %v", step.alerts)
+		}
+
+		record, err := state.ReadConfig(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(record.Reason).To(Equal(`alerts {alertname="EtcdNoSpaceAlarm"} are firing`))
+		Expect(record.Values).To(HaveKeyWithValue(`{alertname="EtcdDBSizeHigh",cluster="stone-prd-1"}`, 0.0))
+	})
+
+	It("Should only apply a level once all its selectors match", func(ctx context.Context) {
+		querier := etcd_shield.NewQuerier(prom, state, etcd_shield.Config{
+			Prometheus: etcd_shield.PrometheusConfig{
+				Alerts: &etcd_shield.AlertSelectors{
+					Match: etcd_shield.AlertMatchAll,
+					Selectors: []etcd_shield.AlertSelector{
+						{Matchers: []string{`alertname="EtcdDBSizeHigh"`}},
+						{Matchers: []string{`alertname=~"Etcd.*Latency"`, `severity!="info"`}},
+					},
+				},
+			},
+		})
+
+		prom.alerts = []model.LabelSet{{"alertname": "EtcdDBSizeHigh"}, {"alertname": "EtcdCommitLatency", "severity": "info"}}
+		Expect(querier.Process(ctx)).To(Succeed())
+		Expect(state.ReadConfig(ctx)).To(HaveField("Level", etcd_shield.LevelOpen))
+
+		prom.alerts = append(prom.alerts, model.LabelSet{"alertname": "EtcdApplyLatency", "severity": "warning"})
+		Expect(querier.Process(ctx)).To(Succeed())
+		Expect(state.ReadConfig(ctx)).To(HaveField("Level", etcd_shield.LevelClosed))
+	})
+
+	It("Should resolve percentage thresholds against the discovered quota", func(ctx context.Context) {
+		cfg := etcd_shield.Config{
+			Prometheus: etcd_shield.PrometheusConfig{
+				Query:          "max(etcd_mvcc_db_total_size_in_bytes)",
+				SetThreshold:   etcd_shield.NewPercentThreshold(95),
+				ResetThreshold: etcd_shield.NewPercentThreshold(80),
+			},
+		}
+		cfg.Default()
+		querier := etcd_shield.NewQuerier(prom, state, cfg)
+		prom.queries = map[string]float64{"max(etcd_server_quota_backend_bytes)": 1000}
+
+		prom.value = 960
+		Expect(querier.Process(ctx)).To(Succeed())
+		record, err := state.ReadConfig(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(record.Level).To(Equal(etcd_shield.LevelClosed))
+		Expect(record.Reason).To(Equal("query value 960 reached the set threshold of 950"))
+		Expect(record.Values).To(HaveKeyWithValue(etcd_shield.QUOTA_VALUE, 1000.0))
+
+		// a bigger quota moves the thresholds with it
+		prom.queries["max(etcd_server_quota_backend_bytes)"] = 2000
+		Expect(querier.Process(ctx)).To(Succeed())
+		Expect(state.ReadConfig(ctx)).To(HaveField("Level", etcd_shield.LevelOpen))
+	})
+
+	It("Should fall back to the configured quota", func(ctx context.Context) {
+		fallback := resource.MustParse("1Ki")
+		cfg := etcd_shield.Config{
+			Prometheus: etcd_shield.PrometheusConfig{
+				Query:          "max(etcd_mvcc_db_total_size_in_bytes)",
+				SetThreshold:   etcd_shield.NewPercentThreshold(50),
+				ResetThreshold: etcd_shield.NewPercentThreshold(50),
+			},
+			Quota: etcd_shield.QuotaConfig{Fallback: &fallback},
+		}
+		cfg.Default()
+		querier := etcd_shield.NewQuerier(prom, state, cfg)
+		prom.failing = map[string]bool{"max(etcd_server_quota_backend_bytes)": true}
+
+		prom.value = 600
+		Expect(querier.Process(ctx)).To(Succeed())
+		Expect(state.ReadConfig(ctx)).To(HaveField("Values", HaveKeyWithValue(etcd_shield.QUOTA_VALUE, 1024.0)))
+		Expect(state.ReadConfig(ctx)).To(HaveField("Level", etcd_shield.LevelClosed))
+
+		cfg.Quota.Fallback = nil
+		querier = etcd_shield.NewQuerier(prom, state, cfg)
+		Expect(querier.Process(ctx)).To(MatchError(ContainSubstring("failed to discover the etcd quota")))
+	})
+
+	It("Should still apply the alerts when only the prediction's quota can't be discovered", func(ctx context.Context) {
+		cfg := etcd_shield.Config{
+			Prometheus: etcd_shield.PrometheusConfig{AlertName: "deny"},
+			Prediction: &etcd_shield.PredictionConfig{Query: "max(etcd_mvcc_db_total_size_in_bytes)"},
+		}
+		cfg.Default()
+		querier := etcd_shield.NewQuerier(prom, state, cfg)
+		prom.failing = map[string]bool{"max(etcd_server_quota_backend_bytes)": true}
+		prom.series = growingSeries(5000, 1)
+
+		prom.firing["deny"] = true
+		Expect(querier.Process(ctx)).To(Succeed())
+		record, err := state.ReadConfig(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(record.Level).To(Equal(etcd_shield.LevelClosed))
+		Expect(record.Reason).To(Equal("alert deny is firing"))
+		Expect(record.Values).NotTo(HaveKey(etcd_shield.GROWTH_VALUE))
+	})
+
+	It("Should wait for consecutive observations before changing the level", func(ctx context.Context) {
+		querier := etcd_shield.NewQuerier(prom, state, etcd_shield.Config{
+			Prometheus: etcd_shield.PrometheusConfig{AlertName: "deny"},
+			Damping:    etcd_shield.DampingConfig{Observations: 3},
+		})
+
+		steps := []struct {
+			deny    bool
+			level   etcd_shield.Level
+			pending int
+		}{
+			{false, etcd_shield.LevelOpen, 0},
+			{true, etcd_shield.LevelOpen, 1},
+			{false, etcd_shield.LevelOpen, 0},
+			{true, etcd_shield.LevelOpen, 1},
+			{true, etcd_shield.LevelOpen, 2},
+			{true, etcd_shield.LevelClosed, 0},
+		}
+		for i, step := range steps {
+			prom.firing["deny"] = step.deny
+			Expect(querier.Process(ctx)).To(Succeed())
+			record, err := state.ReadConfig(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(record.Level).To(Equal(step.level), "step %d", i)
+			Expect(record.PendingCount).To(Equal(step.pending), "step %d", i)
+		}
+	})
+
+	It("Should not count triggered checks as further observations", func(ctx context.Context) {
+		counted := &countingState{StateManager: state}
+		querier := etcd_shield.NewQuerier(prom, counted, etcd_shield.Config{
+			Prometheus: etcd_shield.PrometheusConfig{AlertName: "deny"},
+			Damping:    etcd_shield.DampingConfig{Observations: 3},
+			// long enough that only triggers process the state
+			WaitTime: etcd_shield.NewDuration(time.Hour),
+		})
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			defer GinkgoRecover()
+			Expect(querier.Start(ctx)).To(Succeed())
+		}()
+		Eventually(querier.Trigger).Should(BeTrue())
+		Eventually(counted.writes.Load).Should(BeEquivalentTo(1))
+
+		prom.firing["deny"] = true
+		for i := 2; i <= 6; i++ {
+			Expect(querier.Trigger()).To(BeTrue())
+			Eventually(counted.writes.Load).Should(BeEquivalentTo(i))
+		}
+		record := func() (*etcd_shield.StateRecord, error) { return state.ReadConfig(ctx) }
+		Expect(record()).To(And(HaveField("Level", etcd_shield.LevelOpen), HaveField("PendingCount", 1)))
+
+		// scheduled checks add to the count
+		Expect(querier.Process(ctx)).To(Succeed())
+		Expect(querier.Process(ctx)).To(Succeed())
+		Expect(record()).To(HaveField("Level", etcd_shield.LevelClosed))
+	})
+
+	It("Should keep each level for its minimum time", func(ctx context.Context) {
+		querier := etcd_shield.NewQuerier(prom, state, etcd_shield.Config{
+			Prometheus: etcd_shield.PrometheusConfig{AlertName: "deny"},
+			Damping: etcd_shield.DampingConfig{
+				MinOpen:   etcd_shield.Duration{Duration: time.Minute},
+				MinClosed: etcd_shield.Duration{Duration: 10 * time.Minute},
+			},
+		})
+
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{
+			Level:              etcd_shield.LevelClosed,
+			LastTransitionTime: metav1.NewTime(time.Now().Add(-5 * time.Minute)),
+		})).To(Succeed())
+		Expect(querier.Process(ctx)).To(Succeed())
+		record, err := state.ReadConfig(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(record.Level).To(Equal(etcd_shield.LevelClosed))
+		Expect(record.PendingLevel).To(Equal(etcd_shield.LevelOpen))
+		Expect(record.Reason).To(HavePrefix("staying closed since the minimum closed time of 10m0s has"))
+
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{
+			Level:              etcd_shield.LevelClosed,
+			LastTransitionTime: metav1.NewTime(time.Now().Add(-11 * time.Minute)),
+		})).To(Succeed())
+		Expect(querier.Process(ctx)).To(Succeed())
+		record, err = state.ReadConfig(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(record.Level).To(Equal(etcd_shield.LevelOpen))
+		Expect(record.PendingLevel).To(BeEmpty())
+
+		// just reopened, so closing has to wait
+		prom.firing["deny"] = true
+		Expect(querier.Process(ctx)).To(Succeed())
+		Expect(state.ReadConfig(ctx)).To(HaveField("Level", etcd_shield.LevelOpen))
+	})
+
+	It("Should start a ramp when admission reopens", func(ctx context.Context) {
+		querier := etcd_shield.NewQuerier(prom, state, etcd_shield.Config{
+			Prometheus: etcd_shield.PrometheusConfig{AlertName: "deny"},
+			Ramp: &etcd_shield.RampConfig{
+				Duration:        etcd_shield.NewDuration(time.Hour),
+				Mode:            etcd_shield.RampExponential,
+				InitialFraction: 0.05,
+			},
+		})
+
+		Expect(querier.Process(ctx)).To(Succeed())
+		Expect(state.ReadConfig(ctx)).To(HaveField("Ramp", BeNil()))
+
+		prom.firing["deny"] = true
+		Expect(querier.Process(ctx)).To(Succeed())
+		Expect(state.ReadConfig(ctx)).To(HaveField("Ramp", BeNil()))
+
+		prom.firing["deny"] = false
+		Expect(querier.Process(ctx)).To(Succeed())
+		reopened, err := state.ReadConfig(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reopened.Level).To(Equal(etcd_shield.LevelOpen))
+		Expect(reopened.Ramp).To(Equal(&etcd_shield.RampState{
+			Start:           reopened.LastTransitionTime,
+			Duration:        etcd_shield.NewDuration(time.Hour),
+			Mode:            etcd_shield.RampExponential,
+			InitialFraction: 0.05,
+		}))
+
+		// the ramp carries on until it's done
+		Expect(querier.Process(ctx)).To(Succeed())
+		Expect(state.ReadConfig(ctx)).To(HaveField("Ramp", Equal(reopened.Ramp)))
+	})
+
+	It("Should keep its signal source across reloads that don't change it", func(ctx context.Context) {
+		cfg := etcd_shield.Config{Prometheus: etcd_shield.PrometheusConfig{AlertName: "deny"}}
+		querier := etcd_shield.NewQuerier(prom, state, cfg)
+
+		cfg.Denial.Code = 503
+		commit, abort, err := querier.PrepareReload(&cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(abort).To(BeNil())
+		commit()
+
+		// still answered by the fake, rather than a new connection to nowhere
+		prom.firing["deny"] = true
+		Expect(querier.Process(ctx)).To(Succeed())
+		Expect(state.ReadConfig(ctx)).To(HaveField("Level", etcd_shield.LevelClosed))
+	})
+})
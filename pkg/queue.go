@@ -0,0 +1,151 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	tektonv1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// Releaser releases `PipelineRuns` queued by the webhook, oldest first, once
+// admission reopens.
+type Releaser struct {
+	client client.Client
+	reader client.Reader
+	state  StateManager
+	config atomic.Pointer[Config]
+}
+
+// NewReleaser creates a Releaser.  Queued `PipelineRuns` can live in any
+// namespace, so they're listed with reader, which shouldn't be limited to the
+// manager's cache.
+func NewReleaser(cli client.Client, reader client.Reader, state StateManager, config Config) *Releaser {
+	releaser := Releaser{
+		client: cli,
+		reader: reader,
+		state:  state,
+	}
+	releaser.config.Store(&config)
+
+	return &releaser
+}
+
+var _ manager.Runnable = &Releaser{}
+var _ manager.LeaderElectionRunnable = &Releaser{}
+var _ Reloader = &Releaser{}
+
+// PrepareReload swaps in cfg once committed.
+func (r *Releaser) PrepareReload(cfg *Config) (func(), func(), error) {
+	return func() { r.config.Store(cfg) }, nil, nil
+}
+
+func (r *Releaser) NeedLeaderElection() bool {
+	// releases need to be done once, in order
+	return true
+}
+
+func (r *Releaser) Start(ctx context.Context) error {
+	l := logr.FromContextOrDiscard(ctx)
+	waitTime := r.config.Load().WaitTime.Duration
+	ticker := time.NewTicker(waitTime)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := r.Release(ctx)
+			if err != nil {
+				l.Error(err, "failed to release queued pipelineruns")
+			}
+			if reloaded := r.config.Load().WaitTime.Duration; reloaded != waitTime {
+				waitTime = reloaded
+				ticker.Reset(waitTime)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Release clears the pending status of up to a batch of queued
+// `PipelineRuns` while admission is open.  While it's ramping up, only the
+// `PipelineRuns` the ramp would admit are released.
+func (r *Releaser) Release(ctx context.Context) error {
+	l := logr.FromContextOrDiscard(ctx)
+	cfg := r.config.Load()
+
+	record, err := r.state.ReadConfig(ctx)
+	if err != nil {
+		return err
+	}
+	level, warning := EffectiveLevel(record, cfg.Staleness, time.Now())
+	if warning != "" {
+		l.Info("state is stale", "warning", warning)
+	}
+	if level != LevelOpen {
+		return nil
+	}
+
+	queued := tektonv1.PipelineRunList{}
+	err = r.reader.List(ctx, &queued, client.MatchingLabels{QUEUED_LABEL: "true"})
+	if err != nil {
+		return err
+	}
+
+	items := queued.Items
+	if ramp := record.Ramp; record.Level == LevelOpen && ramp != nil {
+		// release the same PipelineRuns the webhook would admit while ramping up
+		fraction := ramp.Fraction(time.Now())
+		ramping := items[:0]
+		for i := range items {
+			if hashFraction(items[i].Namespace, objectName(&items[i])) < fraction {
+				ramping = append(ramping, items[i])
+			}
+		}
+		items = ramping
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i].CreationTimestamp, items[j].CreationTimestamp
+		if !a.Equal(&b) {
+			return a.Before(&b)
+		}
+		return items[i].Namespace+"/"+items[i].Name < items[j].Namespace+"/"+items[j].Name
+	})
+	if cfg.Queue.BatchSize > 0 && len(items) > cfg.Queue.BatchSize {
+		items = items[:cfg.Queue.BatchSize]
+	}
+
+	for i := range items {
+		pr := &items[i]
+		patch := client.MergeFrom(pr.DeepCopy())
+		if pr.Spec.Status == tektonv1.PipelineRunSpecStatusPending {
+			pr.Spec.Status = ""
+		}
+		delete(pr.Labels, QUEUED_LABEL)
+		err := r.client.Patch(ctx, pr, patch)
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		l.Info("released queued pipelinerun", "namespace", pr.Namespace, "name", pr.Name)
+	}
+
+	return nil
+}
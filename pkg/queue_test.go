@@ -0,0 +1,179 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	etcd_shield "github.com/konflux-ci/etcd-shield/pkg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	tektonv1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func tektonScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(tektonv1.AddToScheme(scheme))
+	return scheme
+}
+
+var _ = Describe("Pkg/Queue", func() {
+	var cli client.Client
+	var state etcd_shield.StateManager
+	var webhook *etcd_shield.Webhook
+	var releaser *etcd_shield.Releaser
+
+	BeforeEach(func() {
+		cli = fake.NewClientBuilder().WithScheme(tektonScheme()).Build()
+		state = etcd_shield.NewState(cli, types.NamespacedName{Name: "state", Namespace: "etcd-shield"})
+		cfg := etcd_shield.Config{Queue: etcd_shield.QueueConfig{Enabled: true, BatchSize: 2}}
+
+		var err error
+		webhook, err = etcd_shield.NewWebhook(state, cfg, cli)
+		Expect(err).NotTo(HaveOccurred())
+		releaser = etcd_shield.NewReleaser(cli, cli, state, cfg)
+	})
+
+	// submit runs pr through both webhooks and creates it if admitted
+	submit := func(ctx context.Context, pr *tektonv1.PipelineRun) error {
+		Expect(webhook.Default(ctx, pr)).To(Succeed())
+		if response := create(ctx, webhook, pr); !response.Allowed {
+			return errors.New(response.Result.Message)
+		}
+		return cli.Create(ctx, pr)
+	}
+
+	It("Should leave PipelineRuns alone while open", func(ctx context.Context) {
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelOpen})).To(Succeed())
+		pr := pipelineRun("tenant", "build")
+		Expect(submit(ctx, pr)).To(Succeed())
+		Expect(pr.IsPending()).To(BeFalse())
+		Expect(pr.Labels).NotTo(HaveKey(etcd_shield.QUEUED_LABEL))
+	})
+
+	It("Should still deny throttled PipelineRuns", func(ctx context.Context) {
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelThrottled})).To(Succeed())
+		pr := pipelineRun("tenant", "build")
+		Expect(submit(ctx, pr)).NotTo(Succeed())
+		Expect(pr.IsPending()).To(BeFalse())
+	})
+
+	It("Should apply the PipelineRun resource's level overrides before queueing", func(ctx context.Context) {
+		resource := etcd_shield.DefaultResource
+		resource.Levels = map[etcd_shield.Level]etcd_shield.Level{etcd_shield.LevelClosed: etcd_shield.LevelThrottled}
+		cfg := etcd_shield.Config{
+			Resources: []etcd_shield.ResourceConfig{resource},
+			Queue:     etcd_shield.QueueConfig{Enabled: true},
+			Throttle:  &etcd_shield.ThrottleConfig{Fraction: 1},
+		}
+		cfg.Default()
+		var err error
+		webhook, err = etcd_shield.NewWebhook(state, cfg, cli)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelClosed})).To(Succeed())
+		pr := pipelineRun("tenant", "build")
+		Expect(submit(ctx, pr)).To(Succeed())
+		Expect(pr.IsPending()).To(BeFalse())
+		Expect(pr.Labels).NotTo(HaveKey(etcd_shield.QUEUED_LABEL))
+	})
+
+	It("Should not release PipelineRuns pending for other reasons", func(ctx context.Context) {
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelOpen})).To(Succeed())
+		pr := pipelineRun("tenant", "build")
+		pr.Spec.Status = tektonv1.PipelineRunSpecStatusPending
+		Expect(submit(ctx, pr)).To(Succeed())
+
+		Expect(releaser.Release(ctx)).To(Succeed())
+		Expect(cli.Get(ctx, client.ObjectKeyFromObject(pr), pr)).To(Succeed())
+		Expect(pr.IsPending()).To(BeTrue())
+	})
+
+	It("Should queue PipelineRuns while closed and release them oldest first once open", func(ctx context.Context) {
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelClosed})).To(Succeed())
+
+		now := time.Now()
+		for i := 0; i < 3; i++ {
+			pr := pipelineRun("tenant", fmt.Sprintf("build-%d", i))
+			pr.CreationTimestamp = metav1.NewTime(now.Add(time.Duration(-i) * time.Minute))
+			Expect(submit(ctx, pr)).To(Succeed())
+			Expect(pr.IsPending()).To(BeTrue())
+			Expect(pr.Labels).To(HaveKeyWithValue(etcd_shield.QUEUED_LABEL, "true"))
+		}
+
+		// nothing is released while closed
+		Expect(releaser.Release(ctx)).To(Succeed())
+		pending := func() []string {
+			list := tektonv1.PipelineRunList{}
+			Expect(cli.List(ctx, &list)).To(Succeed())
+			names := []string{}
+			for _, pr := range list.Items {
+				if pr.IsPending() {
+					names = append(names, pr.Name)
+				}
+			}
+			return names
+		}
+		Expect(pending()).To(HaveLen(3))
+
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelOpen})).To(Succeed())
+		Expect(releaser.Release(ctx)).To(Succeed())
+		Expect(pending()).To(ConsistOf("build-0"))
+
+		Expect(releaser.Release(ctx)).To(Succeed())
+		Expect(pending()).To(BeEmpty())
+	})
+
+	It("Should only release the PipelineRuns a ramp admits", func(ctx context.Context) {
+		releaser := etcd_shield.NewReleaser(cli, cli, state, etcd_shield.Config{Queue: etcd_shield.QueueConfig{Enabled: true}})
+		for i := 0; i < 400; i++ {
+			pr := pipelineRun("tenant", fmt.Sprintf("build-%d", i))
+			pr.Spec.Status = tektonv1.PipelineRunSpecStatusPending
+			pr.SetLabels(map[string]string{etcd_shield.QUEUED_LABEL: "true"})
+			Expect(cli.Create(ctx, pr)).To(Succeed())
+		}
+		queued := func() int {
+			list := tektonv1.PipelineRunList{}
+			Expect(cli.List(ctx, &list, client.MatchingLabels{etcd_shield.QUEUED_LABEL: "true"})).To(Succeed())
+			return len(list.Items)
+		}
+
+		ramp := &etcd_shield.RampState{
+			Start:           metav1.NewTime(time.Now().Add(-90 * time.Second)),
+			Duration:        etcd_shield.NewDuration(9 * time.Minute),
+			Mode:            etcd_shield.RampLinear,
+			InitialFraction: 0.1,
+		}
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelOpen, Ramp: ramp})).To(Succeed())
+		Expect(releaser.Release(ctx)).To(Succeed())
+		Expect(queued()).To(BeNumerically("~", 300, 40))
+
+		ramp.Start = metav1.NewTime(time.Now().Add(-time.Hour))
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelOpen, Ramp: ramp})).To(Succeed())
+		Expect(releaser.Release(ctx)).To(Succeed())
+		Expect(queued()).To(BeZero())
+	})
+})
@@ -0,0 +1,89 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield
+
+import (
+	"math"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RampState is a ramp up in progress, written by the querier so that every
+// webhook replica admits the same fraction at the same time, whatever config
+// it has loaded.
+type RampState struct {
+	// Start is when admission reopened.
+	Start metav1.Time `json:"start"`
+
+	// Duration is how long the ramp lasts from Start.
+	Duration Duration `json:"duration"`
+
+	// Mode is how the fraction grows.
+	Mode RampMode `json:"mode"`
+
+	// InitialFraction is the fraction admitted at Start.
+	InitialFraction float64 `json:"initialFraction"`
+}
+
+// Fraction is the fraction of `PipelineRuns` admitted at now, reaching 1 once
+// the ramp is over.
+func (r *RampState) Fraction(now time.Time) float64 {
+	if r.Duration.Duration <= 0 {
+		return 1
+	}
+	progress := float64(now.Sub(r.Start.Time)) / float64(r.Duration.Duration)
+	if progress >= 1 {
+		return 1
+	}
+	progress = math.Max(progress, 0)
+
+	initial := math.Min(math.Max(r.InitialFraction, 0), 1)
+	switch r.Mode {
+	case RampExponential:
+		if initial == 0 {
+			return 0
+		}
+		return initial * math.Pow(1/initial, progress)
+	default:
+		return initial + (1-initial)*progress
+	}
+}
+
+// Done indicates whether the ramp is over at now.
+func (r *RampState) Done(now time.Time) bool {
+	return !now.Before(r.Start.Add(r.Duration.Duration))
+}
+
+// nextRamp is the ramp to write along with record: a new one when admission
+// reopens, the current one until it's done, or nil.
+func nextRamp(cfg *RampConfig, current, record *StateRecord, now time.Time) *RampState {
+	if cfg == nil || record.Level != LevelOpen {
+		return nil
+	}
+
+	if current.Level != LevelOpen {
+		return &RampState{
+			Start:           metav1.NewTime(now),
+			Duration:        cfg.Duration,
+			Mode:            cfg.Mode,
+			InitialFraction: cfg.InitialFraction,
+		}
+	}
+	if current.Ramp != nil && !current.Ramp.Done(now) {
+		return current.Ramp
+	}
+	return nil
+}
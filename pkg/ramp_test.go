@@ -0,0 +1,48 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield_test
+
+import (
+	"time"
+
+	etcd_shield "github.com/konflux-ci/etcd-shield/pkg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Pkg/Ramp", func() {
+	start := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	DescribeTable("Should grow the admitted fraction over the ramp",
+		func(mode etcd_shield.RampMode, elapsed time.Duration, fraction float64) {
+			ramp := etcd_shield.RampState{
+				Start:           metav1.NewTime(start),
+				Duration:        etcd_shield.NewDuration(10 * time.Minute),
+				Mode:            mode,
+				InitialFraction: 0.01,
+			}
+			Expect(ramp.Fraction(start.Add(elapsed))).To(BeNumerically("~", fraction, 1e-9))
+			Expect(ramp.Done(start.Add(elapsed))).To(Equal(fraction == 1))
+		},
+		Entry("linear at the start", etcd_shield.RampLinear, time.Duration(0), 0.01),
+		Entry("linear halfway", etcd_shield.RampLinear, 5*time.Minute, 0.505),
+		Entry("linear at the end", etcd_shield.RampLinear, 10*time.Minute, 1.0),
+		Entry("exponential at the start", etcd_shield.RampExponential, time.Duration(0), 0.01),
+		Entry("exponential halfway", etcd_shield.RampExponential, 5*time.Minute, 0.1),
+		Entry("exponential at the end", etcd_shield.RampExponential, 10*time.Minute, 1.0),
+		Entry("after the end", etcd_shield.RampExponential, time.Hour, 1.0),
+	)
+})
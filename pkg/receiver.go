@@ -0,0 +1,173 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// RECEIVER_PATH is where the Receiver accepts Alertmanager notifications.
+const RECEIVER_PATH = "/alertmanager"
+
+// Receiver implements an Alertmanager webhook receiver.  Notifications about
+// firing or resolved alerts trigger the Querier right away, so the shield
+// doesn't wait for its next tick; polling carries on as a backstop.
+type Receiver struct {
+	querier *Querier
+	config  ReceiverConfig
+	tlsOpts []func(*tls.Config)
+}
+
+// NewReceiver creates a Receiver that triggers querier.  tlsOpts configure the
+// serving certificate.
+func NewReceiver(querier *Querier, cfg ReceiverConfig, tlsOpts ...func(*tls.Config)) *Receiver {
+	return &Receiver{
+		querier: querier,
+		config:  cfg,
+		tlsOpts: tlsOpts,
+	}
+}
+
+var _ manager.Runnable = &Receiver{}
+var _ manager.LeaderElectionRunnable = &Receiver{}
+var _ http.Handler = &Receiver{}
+
+func (r *Receiver) NeedLeaderElection() bool {
+	// every replica listens, and those that aren't leading turn callers away
+	// so Alertmanager retries elsewhere
+	return false
+}
+
+func (r *Receiver) Start(ctx context.Context) error {
+	l := logr.FromContextOrDiscard(ctx)
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	for _, opt := range r.tlsOpts {
+		opt(tlsConfig)
+	}
+	if r.config.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.config.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read receiver client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", r.config.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(RECEIVER_PATH, r)
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	listener, err := tls.Listen("tcp", r.config.BindAddress, tlsConfig)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdown)
+	}()
+
+	l.Info("serving alertmanager receiver", "address", r.config.BindAddress, "path", RECEIVER_PATH)
+	err = server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// notification is the part of an Alertmanager webhook payload we log.
+type notification struct {
+	Status string `json:"status"`
+	Alerts []struct {
+		Status string            `json:"status"`
+		Labels map[string]string `json:"labels"`
+	} `json:"alerts"`
+}
+
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	l := logr.FromContextOrDiscard(req.Context())
+
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.authorize(req); err != nil {
+		l.Info("rejected alertmanager notification", "remote", req.RemoteAddr, "reason", err.Error())
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	payload := notification{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<20)).Decode(&payload); err != nil {
+		http.Error(w, fmt.Sprintf("invalid notification: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// the querier checks the signals itself, so the notification only says when
+	if !r.querier.Trigger() {
+		http.Error(w, "querier isn't running on this replica", http.StatusServiceUnavailable)
+		return
+	}
+	l.Info("alertmanager notification triggered the querier", "status", payload.Status, "alerts", len(payload.Alerts))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// authorize checks the caller's bearer token, if one is configured.  Client
+// certificates are verified during the TLS handshake.
+func (r *Receiver) authorize(req *http.Request) error {
+	if r.config.BearerTokenFile == "" {
+		return nil
+	}
+
+	expected, err := os.ReadFile(r.config.BearerTokenFile)
+	if err != nil {
+		return fmt.Errorf("failed to read bearer token: %w", err)
+	}
+	token := strings.TrimSpace(string(expected))
+	if token == "" {
+		return fmt.Errorf("bearer token file is empty")
+	}
+
+	given, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		return fmt.Errorf("missing or invalid bearer token")
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	etcd_shield "github.com/konflux-ci/etcd-shield/pkg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const firingNotification = `{
+  "version": "4",
+  "status": "firing",
+  "alerts": [{"status": "firing", "labels": {"alertname": "deny"}}]
+}`
+
+var _ = Describe("Pkg/Receiver", func() {
+	var prom *fakePrometheus
+	var state etcd_shield.StateManager
+	var querier *etcd_shield.Querier
+	var receiver *etcd_shield.Receiver
+
+	BeforeEach(func() {
+		prom = &fakePrometheus{firing: map[string]bool{}}
+		state = etcd_shield.NewState(fake.NewClientBuilder().Build(), types.NamespacedName{Name: "state", Namespace: "etcd-shield"})
+		querier = etcd_shield.NewQuerier(prom, state, etcd_shield.Config{
+			Prometheus: etcd_shield.PrometheusConfig{AlertName: "deny"},
+			// long enough that only the receiver can trigger processing
+			WaitTime: etcd_shield.NewDuration(time.Hour),
+		})
+
+		tokenFile := filepath.Join(GinkgoT().TempDir(), "token")
+		Expect(os.WriteFile(tokenFile, []byte("s3cret\n"), 0o600)).To(Succeed())
+		receiver = etcd_shield.NewReceiver(querier, etcd_shield.ReceiverConfig{BearerTokenFile: tokenFile})
+	})
+
+	notify := func(token string) int {
+		req := httptest.NewRequest(http.MethodPost, etcd_shield.RECEIVER_PATH, strings.NewReader(firingNotification))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		receiver.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	It("Should turn callers away while the querier isn't running", func() {
+		Expect(notify("s3cret")).To(Equal(http.StatusServiceUnavailable))
+	})
+
+	It("Should process the state as soon as a notification arrives", func(ctx context.Context) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			defer GinkgoRecover()
+			Expect(querier.Start(ctx)).To(Succeed())
+		}()
+		Eventually(querier.Trigger).Should(BeTrue())
+		Eventually(func() (*etcd_shield.StateRecord, error) { return state.ReadConfig(ctx) }).
+			Should(HaveField("LastCheckTime.IsZero()", BeFalse()))
+
+		prom.firing["deny"] = true
+		Expect(notify("s3cret")).To(Equal(http.StatusAccepted))
+		Eventually(func() (*etcd_shield.StateRecord, error) { return state.ReadConfig(ctx) }).
+			Should(HaveField("Level", etcd_shield.LevelClosed))
+	})
+
+	It("Should reject callers without the bearer token", func() {
+		Expect(notify("")).To(Equal(http.StatusUnauthorized))
+		Expect(notify("guess")).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("Should reject invalid notifications", func() {
+		req := httptest.NewRequest(http.MethodPost, etcd_shield.RECEIVER_PATH, strings.NewReader("{"))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		rec := httptest.NewRecorder()
+		receiver.ServeHTTP(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+
+		req = httptest.NewRequest(http.MethodGet, etcd_shield.RECEIVER_PATH, nil)
+		rec = httptest.NewRecorder()
+		receiver.ServeHTTP(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
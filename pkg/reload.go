@@ -0,0 +1,170 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// Reloader is a component that can swap in a new config while running.
+type Reloader interface {
+	// PrepareReload builds whatever is needed to run with cfg, returning a
+	// function that swaps it in, and one that releases what was built if
+	// another Reloader rejects cfg.  abort may be nil.  An error rejects cfg.
+	PrepareReload(cfg *Config) (commit func(), abort func(), err error)
+}
+
+// ConfigWatcher polls the config file for changes and reloads them into its
+// Reloaders.  Polling rather than relying on file events keeps this working
+// with the symlink swaps done for mounted ConfigMaps.
+type ConfigWatcher struct {
+	path      string
+	interval  time.Duration
+	role      Role
+	reloaders []Reloader
+
+	current  *Config
+	contents []byte
+}
+
+// NewConfigWatcher creates a ConfigWatcher for the file at path, which was
+// last loaded as current, checking it every interval.  Changes are validated
+// for role.
+func NewConfigWatcher(path string, interval time.Duration, role Role, current *Config, reloaders ...Reloader) (*ConfigWatcher, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("config reload interval %s must be positive", interval)
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConfigWatcher{
+		path:      path,
+		interval:  interval,
+		role:      role,
+		reloaders: reloaders,
+		current:   current,
+		contents:  contents,
+	}, nil
+}
+
+var _ manager.Runnable = &ConfigWatcher{}
+var _ manager.LeaderElectionRunnable = &ConfigWatcher{}
+
+func (c *ConfigWatcher) NeedLeaderElection() bool {
+	// every replica runs with its own copy of the config
+	return false
+}
+
+func (c *ConfigWatcher) Start(ctx context.Context) error {
+	l := logr.FromContextOrDiscard(ctx)
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := c.Check(ctx)
+			if err != nil {
+				l.Error(err, "rejected config update", "path", c.path)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Check reloads the config file if it changed since it was last seen.  The new
+// config is only swapped in if every Reloader accepts it; otherwise the running
+// config is kept and an error is returned.
+func (c *ConfigWatcher) Check(ctx context.Context) error {
+	l := logr.FromContextOrDiscard(ctx)
+
+	contents, err := os.ReadFile(c.path)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(contents, c.contents) {
+		return nil
+	}
+	// remember the contents even if rejected, so we only complain once per change
+	c.contents = contents
+
+	cfg, err := ParseConfig(contents, c.role)
+	if err != nil {
+		return err
+	}
+	if err := c.checkImmutable(cfg); err != nil {
+		return err
+	}
+
+	commits := make([]func(), 0, len(c.reloaders))
+	aborts := make([]func(), 0, len(c.reloaders))
+	for _, reloader := range c.reloaders {
+		commit, abort, err := reloader.PrepareReload(cfg)
+		if err != nil {
+			for _, abort := range aborts {
+				abort()
+			}
+			return err
+		}
+		commits = append(commits, commit)
+		if abort != nil {
+			aborts = append(aborts, abort)
+		}
+	}
+	for _, commit := range commits {
+		commit()
+	}
+	c.current = cfg
+
+	l.Info("reloaded config", "path", c.path)
+	return nil
+}
+
+// checkImmutable rejects changes to the parts of the config that are only read
+// on startup.
+func (c *ConfigWatcher) checkImmutable(cfg *Config) error {
+	if cfg.DestName != c.current.DestName || cfg.DestNamespace != c.current.DestNamespace {
+		return fmt.Errorf("changing destName or destNamespace requires a restart")
+	}
+	if cfg.Queue.Enabled != c.current.Queue.Enabled {
+		return fmt.Errorf("changing queue.enabled requires a restart")
+	}
+	if !reflect.DeepEqual(cfg.Receiver, c.current.Receiver) {
+		return fmt.Errorf("changing receiver requires a restart")
+	}
+	if !reflect.DeepEqual(cfg.StateFile, c.current.StateFile) {
+		return fmt.Errorf("changing stateFile requires a restart")
+	}
+	if len(cfg.Resources) != len(c.current.Resources) {
+		return fmt.Errorf("changing the resources guarded requires a restart")
+	}
+	for i, resource := range cfg.Resources {
+		current := c.current.Resources[i]
+		if resource.GroupVersionKind() != current.GroupVersionKind() || resource.Path != current.Path {
+			return fmt.Errorf("changing the resources guarded requires a restart")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	etcd_shield "github.com/konflux-ci/etcd-shield/pkg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// recordingReloader remembers the last config committed to it or aborted,
+// optionally rejecting every config.
+type recordingReloader struct {
+	committed *etcd_shield.Config
+	aborted   *etcd_shield.Config
+	reject    bool
+}
+
+func (r *recordingReloader) PrepareReload(cfg *etcd_shield.Config) (func(), func(), error) {
+	if r.reject {
+		return nil, nil, fmt.Errorf("rejected")
+	}
+	return func() { r.committed = cfg }, func() { r.aborted = cfg }, nil
+}
+
+const baseConfig = `
+destName: etcd-shield-state
+destNamespace: etcd-shield
+prometheus:
+  address: http://prometheus:9090
+  alertName: deny
+waitTime: 15s
+`
+
+var _ = Describe("Pkg/Reload", func() {
+	var path string
+	var state etcd_shield.StateManager
+	var webhook *etcd_shield.Webhook
+	var recorder *recordingReloader
+	var watcher *etcd_shield.ConfigWatcher
+
+	write := func(contents string) {
+		Expect(os.WriteFile(path, []byte(contents), 0o600)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		write(baseConfig)
+		cfg, err := etcd_shield.GetConfig(GinkgoLogr, path, etcd_shield.RoleAll)
+		Expect(err).NotTo(HaveOccurred())
+
+		cli := fake.NewClientBuilder().Build()
+		state = etcd_shield.NewState(cli, types.NamespacedName{Name: "state", Namespace: "etcd-shield"})
+		webhook, err = etcd_shield.NewWebhook(state, *cfg, cli)
+		Expect(err).NotTo(HaveOccurred())
+		recorder = &recordingReloader{}
+		watcher, err = etcd_shield.NewConfigWatcher(path, time.Second, etcd_shield.RoleAll, cfg, webhook, recorder)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should need a positive interval", func() {
+		cfg, err := etcd_shield.GetConfig(GinkgoLogr, path, etcd_shield.RoleAll)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = etcd_shield.NewConfigWatcher(path, 0, etcd_shield.RoleAll, cfg, recorder)
+		Expect(err).To(MatchError(ContainSubstring("must be positive")))
+	})
+
+	It("Should do nothing if the config didn't change", func(ctx context.Context) {
+		Expect(watcher.Check(ctx)).To(Succeed())
+		Expect(recorder.committed).To(BeNil())
+	})
+
+	It("Should swap a changed config into every reloader", func(ctx context.Context) {
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelClosed})).To(Succeed())
+		Expect(create(ctx, webhook, pipelineRun("release", "build")).Allowed).To(BeFalse())
+
+		write(baseConfig + "exemptions:\n  namespaces: [release]\n")
+		Expect(watcher.Check(ctx)).To(Succeed())
+		Expect(recorder.committed).NotTo(BeNil())
+		Expect(recorder.committed.Exemptions.Namespaces).To(ConsistOf("release"))
+
+		Expect(create(ctx, webhook, pipelineRun("release", "build")).Allowed).To(BeTrue())
+	})
+
+	DescribeTable("Should reject invalid configs", func(ctx context.Context, contents string) {
+		write(contents)
+		Expect(watcher.Check(ctx)).NotTo(Succeed())
+		Expect(recorder.committed).To(BeNil())
+
+		// the rejected config isn't retried until it changes again
+		Expect(watcher.Check(ctx)).To(Succeed())
+	},
+		Entry("malformed yaml", "destName: [\n"),
+		Entry("negative wait time", strings.Replace(baseConfig, "waitTime: 15s", "waitTime: -15s", 1)),
+		Entry("changed destination", strings.Replace(baseConfig, "destName: etcd-shield-state", "destName: other", 1)),
+		Entry("invalid exemption selector", baseConfig+
+			"exemptions:\n  objectSelector:\n    matchExpressions:\n    - {key: a, operator: Bogus}\n"),
+	)
+
+	It("Should keep every reloader on the old config if one rejects it", func(ctx context.Context) {
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelClosed})).To(Succeed())
+		recorder.reject = true
+
+		write(baseConfig + "exemptions:\n  namespaces: [release]\n")
+		Expect(watcher.Check(ctx)).NotTo(Succeed())
+
+		Expect(create(ctx, webhook, pipelineRun("release", "build")).Allowed).To(BeFalse())
+	})
+
+	It("Should abort what earlier reloaders prepared if a later one rejects it", func(ctx context.Context) {
+		cfg, err := etcd_shield.GetConfig(GinkgoLogr, path, etcd_shield.RoleAll)
+		Expect(err).NotTo(HaveOccurred())
+		accepting, rejecting := &recordingReloader{}, &recordingReloader{reject: true}
+		watcher, err := etcd_shield.NewConfigWatcher(path, time.Second, etcd_shield.RoleAll, cfg, accepting, rejecting)
+		Expect(err).NotTo(HaveOccurred())
+
+		write(baseConfig + "exemptions:\n  namespaces: [release]\n")
+		Expect(watcher.Check(ctx)).NotTo(Succeed())
+		Expect(accepting.committed).To(BeNil())
+		Expect(accepting.aborted).NotTo(BeNil())
+	})
+})
@@ -0,0 +1,124 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield
+
+import (
+	"context"
+	"sync/atomic"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// StateSnapshot is a StateManager that keeps the latest state record in
+// memory, parsed once per change by an informer event handler on the state
+// ConfigMap.  Reads are a single atomic load, so admission never waits on the
+// API server or a parse.  Writes, and reads until the informer has seen the
+// ConfigMap or synced without it, go to the wrapped StateManager.
+type StateSnapshot struct {
+	state  StateManager
+	ref    types.NamespacedName
+	record atomic.Pointer[StateRecord]
+}
+
+var _ StateManager = &StateSnapshot{}
+var _ toolscache.ResourceEventHandler = &StateSnapshot{}
+
+// NewStateSnapshot creates a StateSnapshot of the ConfigMap ref, falling back
+// to state.  It has to be added as an event handler to a ConfigMap informer
+// to see any changes.
+func NewStateSnapshot(state StateManager, ref types.NamespacedName) *StateSnapshot {
+	return &StateSnapshot{state: state, ref: ref}
+}
+
+// ReadConfig returns the latest record, which callers mustn't modify since
+// it's shared.
+func (s *StateSnapshot) ReadConfig(ctx context.Context) (*StateRecord, error) {
+	if record := s.record.Load(); record != nil {
+		return record, nil
+	}
+	return s.state.ReadConfig(ctx)
+}
+
+// WriteConfig writes record through the wrapped StateManager.  The snapshot
+// picks it up once the informer sees the change.
+func (s *StateSnapshot) WriteConfig(ctx context.Context, record *StateRecord) error {
+	return s.state.WriteConfig(ctx, record)
+}
+
+func (s *StateSnapshot) OnAdd(obj interface{}, _ bool) {
+	s.update(obj)
+}
+
+func (s *StateSnapshot) OnUpdate(_, obj interface{}) {
+	s.update(obj)
+}
+
+func (s *StateSnapshot) OnDelete(obj interface{}) {
+	if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if configMap, ok := obj.(*v1.ConfigMap); ok && s.isState(configMap) {
+		// same as reading a missing ConfigMap
+		s.record.Store(&StateRecord{Level: LevelOpen})
+	}
+}
+
+// update swaps in the record parsed from obj, if it's the state ConfigMap.
+func (s *StateSnapshot) update(obj interface{}) {
+	if configMap, ok := obj.(*v1.ConfigMap); ok && s.isState(configMap) {
+		s.record.Store(parseState(configMap.Data))
+	}
+}
+
+// Synced tells the snapshot its informer has delivered every ConfigMap that
+// existed when it started.  If the state wasn't among them it's missing, which
+// is then kept in memory like any other state rather than read through.
+func (s *StateSnapshot) Synced() {
+	// same as reading a missing ConfigMap
+	s.record.CompareAndSwap(nil, &StateRecord{Level: LevelOpen})
+}
+
+// WaitForSync creates a Runnable that calls Synced once hasSynced reports the
+// snapshot's informer registration has synced.
+func (s *StateSnapshot) WaitForSync(hasSynced toolscache.InformerSynced) manager.Runnable {
+	return &snapshotSync{snapshot: s, hasSynced: hasSynced}
+}
+
+// snapshotSync is the Runnable made by StateSnapshot.WaitForSync.
+type snapshotSync struct {
+	snapshot  *StateSnapshot
+	hasSynced toolscache.InformerSynced
+}
+
+var _ manager.LeaderElectionRunnable = &snapshotSync{}
+
+func (s *snapshotSync) NeedLeaderElection() bool {
+	// every webhook replica has its own snapshot
+	return false
+}
+
+func (s *snapshotSync) Start(ctx context.Context) error {
+	if toolscache.WaitForCacheSync(ctx.Done(), s.hasSynced) {
+		s.snapshot.Synced()
+	}
+	return nil
+}
+
+func (s *StateSnapshot) isState(configMap *v1.ConfigMap) bool {
+	return configMap.Name == s.ref.Name && configMap.Namespace == s.ref.Namespace
+}
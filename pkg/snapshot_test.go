@@ -0,0 +1,171 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	etcd_shield "github.com/konflux-ci/etcd-shield/pkg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// allocSink makes objects escape to the heap like they do during admission.
+var allocSink metav1.Object
+
+var stateRef = types.NamespacedName{Name: "state", Namespace: "etcd-shield"}
+
+// stateConfigMap is the state ConfigMap as written for record.
+func stateConfigMap(ctx context.Context, record *etcd_shield.StateRecord) *corev1.ConfigMap {
+	cli := fake.NewClientBuilder().Build()
+	ExpectWithOffset(1, etcd_shield.NewState(cli, stateRef).WriteConfig(ctx, record)).To(Succeed())
+	configMap := &corev1.ConfigMap{}
+	ExpectWithOffset(1, cli.Get(ctx, stateRef, configMap)).To(Succeed())
+	return configMap
+}
+
+var _ = Describe("Pkg/Snapshot", func() {
+	var cli client.Client
+	var snapshot *etcd_shield.StateSnapshot
+
+	BeforeEach(func() {
+		cli = fake.NewClientBuilder().Build()
+		snapshot = etcd_shield.NewStateSnapshot(etcd_shield.NewState(cli, stateRef), stateRef)
+	})
+
+	It("Should read through until the informer sees the state", func(ctx context.Context) {
+		Expect(etcd_shield.NewState(cli, stateRef).WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelClosed})).To(Succeed())
+		Expect(snapshot.ReadConfig(ctx)).To(HaveField("Level", etcd_shield.LevelClosed))
+	})
+
+	It("Should follow the state ConfigMap's events", func(ctx context.Context) {
+		closed := stateConfigMap(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelClosed, Reason: "full"})
+		snapshot.OnAdd(closed, true)
+		Expect(snapshot.ReadConfig(ctx)).To(HaveField("Reason", "full"))
+
+		throttled := stateConfigMap(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelThrottled})
+		snapshot.OnUpdate(closed, throttled)
+		Expect(snapshot.ReadConfig(ctx)).To(HaveField("Level", etcd_shield.LevelThrottled))
+
+		other := stateConfigMap(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelOpen})
+		other.Name = "unrelated"
+		snapshot.OnAdd(other, false)
+		snapshot.OnDelete(other)
+		Expect(snapshot.ReadConfig(ctx)).To(HaveField("Level", etcd_shield.LevelThrottled))
+
+		snapshot.OnDelete(toolscache.DeletedFinalStateUnknown{Key: stateRef.String(), Obj: throttled})
+		Expect(snapshot.ReadConfig(ctx)).To(HaveField("Level", etcd_shield.LevelOpen))
+	})
+
+	It("Should keep a missing state in memory once the informer has synced", func(ctx context.Context) {
+		// the informer hasn't seen this yet, so it's read through
+		Expect(etcd_shield.NewState(cli, stateRef).WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelClosed})).To(Succeed())
+		Expect(snapshot.ReadConfig(ctx)).To(HaveField("Level", etcd_shield.LevelClosed))
+
+		// had it existed when the informer started, it would have been seen by now
+		Expect(snapshot.WaitForSync(func() bool { return true }).Start(ctx)).To(Succeed())
+		Expect(snapshot.ReadConfig(ctx)).To(HaveField("Level", etcd_shield.LevelOpen))
+
+		// a state seen before syncing isn't replaced
+		closed := stateConfigMap(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelClosed})
+		snapshot.OnAdd(closed, true)
+		snapshot.Synced()
+		Expect(snapshot.ReadConfig(ctx)).To(HaveField("Level", etcd_shield.LevelClosed))
+	})
+
+	It("Should write through to the state", func(ctx context.Context) {
+		Expect(snapshot.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelClosed})).To(Succeed())
+		Expect(etcd_shield.NewState(cli, stateRef).ReadConfig(ctx)).To(HaveField("Level", etcd_shield.LevelClosed))
+	})
+
+	It("Should only allocate to decode the request and respond", func(ctx context.Context) {
+		webhook, err := etcd_shield.NewWebhook(snapshot, etcd_shield.Config{}, cli)
+		Expect(err).NotTo(HaveOccurred())
+		snapshot.OnAdd(stateConfigMap(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelOpen}), true)
+		handler := webhook.Handler(pipelineRunGVK)
+		req := pipelineRunRequest(pipelineRun("tenant", "build"))
+
+		var response admission.Response
+		allocs := testing.AllocsPerRun(100, func() {
+			response = handler.Handle(ctx, req)
+		})
+		Expect(response.Allowed).To(BeTrue())
+
+		// reading the state and deciding add nothing to decoding the object's
+		// metadata and building the response
+		baseline := testing.AllocsPerRun(100, func() {
+			obj := &struct {
+				metav1.ObjectMeta `json:"metadata"`
+				Spec              struct {
+					Status string `json:"status"`
+				} `json:"spec"`
+			}{}
+			_ = json.Unmarshal(req.Object.Raw, obj)
+			allocSink = obj
+			response = admission.Allowed("")
+		})
+		Expect(allocs).To(Equal(baseline))
+	})
+})
+
+// BenchmarkHandle measures an admission request with the state read from the
+// cached ConfigMap on every request, and from the in-memory snapshot.
+func BenchmarkHandle(b *testing.B) {
+	ctx := context.Background()
+	for _, level := range []etcd_shield.Level{etcd_shield.LevelOpen, etcd_shield.LevelThrottled, etcd_shield.LevelClosed} {
+		record := &etcd_shield.StateRecord{Level: level, Reason: "alert EtcdDBSizeHigh is firing", Values: map[string]float64{"query": 8.2e9}}
+		cli := fake.NewClientBuilder().Build()
+		state := etcd_shield.NewState(cli, stateRef)
+		if err := state.WriteConfig(ctx, record); err != nil {
+			b.Fatal(err)
+		}
+		configMap := &corev1.ConfigMap{}
+		if err := cli.Get(ctx, stateRef, configMap); err != nil {
+			b.Fatal(err)
+		}
+		snapshot := etcd_shield.NewStateSnapshot(state, stateRef)
+		snapshot.OnAdd(configMap, true)
+
+		cfg := etcd_shield.Config{Throttle: &etcd_shield.ThrottleConfig{Fraction: 0.5}}
+		for name, state := range map[string]etcd_shield.StateManager{"configmap": state, "snapshot": snapshot} {
+			webhook, err := etcd_shield.NewWebhook(state, cfg, cli)
+			if err != nil {
+				b.Fatal(err)
+			}
+			handler := webhook.Handler(pipelineRunGVK)
+			reqs := make([]admission.Request, 64)
+			for i := range reqs {
+				reqs[i] = pipelineRunRequest(pipelineRun("tenant", fmt.Sprintf("build-%d", i)))
+			}
+
+			b.Run(fmt.Sprintf("%s/%s", name, level), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					handler.Handle(ctx, reqs[i%len(reqs)])
+				}
+			})
+		}
+	}
+}
@@ -16,9 +16,14 @@ package etcd_shield
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -26,36 +31,165 @@ import (
 
 type State struct {
 	client.Client
-	ref types.NamespacedName
+	ref      types.NamespacedName
+	identity string
+}
+
+// Level is how much `PipelineRun` ingress is currently allowed.
+type Level string
+
+const (
+	// LevelOpen admits every `PipelineRun`.
+	LevelOpen Level = "open"
+	// LevelThrottled admits only a fraction or a budget of `PipelineRuns`.
+	LevelThrottled Level = "throttled"
+	// LevelClosed denies every `PipelineRun`.
+	LevelClosed Level = "closed"
+)
+
+// ParseLevel converts a string to a Level, returning false if it isn't one
+// we know about.
+func ParseLevel(s string) (Level, bool) {
+	switch level := Level(s); level {
+	case LevelOpen, LevelThrottled, LevelClosed:
+		return level, true
+	default:
+		return "", false
+	}
+}
+
+// STATE_VERSION is the version of StateRecord we write.
+const STATE_VERSION int = 1
+
+// StateRecord is the state written by the querier for the webhooks, along with
+// why and when it was decided.
+type StateRecord struct {
+	// Version is the version of the record's format.  Records read from state
+	// written before the format existed have a version of 0.
+	Version int `json:"version"`
+
+	// Level is the current admission level.
+	Level Level `json:"level"`
+
+	// Reason is a human readable explanation for Level.
+	Reason string `json:"reason,omitempty"`
+
+	// Signal is the alert or query that determined Level.
+	Signal string `json:"signal,omitempty"`
+
+	// Values holds the values observed while determining Level.
+	Values map[string]float64 `json:"values,omitempty"`
+
+	// Latched is the level prometheus.query's set/reset thresholds are latched
+	// at.  It can differ from Level when a prediction, an etcd alarm or damping
+	// decided Level, and is what the thresholds' hysteresis carries over.
+	Latched Level `json:"latched,omitempty"`
+
+	// PendingLevel is the level the signals ask for, but that damping has
+	// held back so far.  Empty when the signals agree with Level.
+	PendingLevel Level `json:"pendingLevel,omitempty"`
+
+	// PendingCount is how many checks in a row asked for PendingLevel.
+	PendingCount int `json:"pendingCount,omitempty"`
+
+	// Ramp is set while admission is ramping up after reopening, limiting
+	// LevelOpen to a growing fraction of `PipelineRuns`.
+	Ramp *RampState `json:"ramp,omitempty"`
+
+	// LastTransitionTime is when Level last changed.
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// LastCheckTime is when the querier last successfully determined Level.
+	LastCheckTime metav1.Time `json:"lastCheckTime,omitempty"`
+
+	// Writer is the identity of the pod that wrote the record.
+	Writer string `json:"writer,omitempty"`
+}
+
+// EffectiveLevel is the level to enforce for record at now, applying the
+// staleness policy.  If the record is stale, a warning explaining why is
+// returned too.
+func EffectiveLevel(record *StateRecord, staleness StalenessConfig, now time.Time) (Level, string) {
+	if staleness.MaxAge.Duration <= 0 {
+		return record.Level, ""
+	}
+
+	var why string
+	if record.LastCheckTime.IsZero() {
+		why = "etcd-shield state has never been refreshed"
+	} else if age := now.Sub(record.LastCheckTime.Time); age > staleness.MaxAge.Duration {
+		why = fmt.Sprintf("etcd-shield state was last refreshed %s ago, at %s",
+			age.Truncate(time.Second), record.LastCheckTime.UTC().Format(time.RFC3339))
+	} else {
+		return record.Level, ""
+	}
+
+	switch staleness.Policy {
+	case StalePolicyFailOpen:
+		return LevelOpen, why + "; admitting PipelineRuns"
+	case StalePolicyFailClosed:
+		return LevelClosed, why + "; denying PipelineRuns"
+	default:
+		return record.Level, fmt.Sprintf("%s; keeping the last admission level of %s", why, record.Level)
+	}
 }
 
 type StateManager interface {
-	ReadConfig(context.Context) (bool, error)
-	WriteConfig(context.Context, bool) error
+	ReadConfig(context.Context) (*StateRecord, error)
+	WriteConfig(context.Context, *StateRecord) error
 }
 
 func NewState(cli client.Client, ref types.NamespacedName) StateManager {
 	return &State{
-		Client: cli,
-		ref:    ref,
+		Client:   cli,
+		ref:      ref,
+		identity: podIdentity(),
 	}
 }
 
+// podIdentity names the pod we're running in, falling back to the hostname
+// when not provided through the downward API.
+func podIdentity() string {
+	if name := os.Getenv("POD_NAME"); name != "" {
+		return name
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+// CONFIG_KEY holds "1" if ingress is open and "0" otherwise.  It's kept for
+// consumers that predate admission levels.
 const CONFIG_KEY string = "allow"
 
-func (s *State) WriteConfig(ctx context.Context, allow bool) error {
+// LEVEL_KEY holds the current Level.  It's kept for consumers that predate
+// StateRecord.
+const LEVEL_KEY string = "level"
+
+// STATE_KEY holds the JSON encoded StateRecord.
+const STATE_KEY string = "state"
+
+func (s *State) WriteConfig(ctx context.Context, record *StateRecord) error {
+	record.Version = STATE_VERSION
+	record.Writer = s.identity
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
 	configMap := v1.ConfigMap{}
 	configMap.SetName(s.ref.Name)
 	configMap.SetNamespace(s.ref.Namespace)
-	_, err := controllerutil.CreateOrPatch(ctx, s.Client, &configMap, func() error {
+	_, err = controllerutil.CreateOrPatch(ctx, s.Client, &configMap, func() error {
 		if configMap.Data == nil {
 			configMap.Data = map[string]string{}
 		}
-		if allow {
+		if record.Level == LevelOpen {
 			configMap.Data[CONFIG_KEY] = "1"
 		} else {
 			configMap.Data[CONFIG_KEY] = "0"
 		}
+		configMap.Data[LEVEL_KEY] = string(record.Level)
+		configMap.Data[STATE_KEY] = string(encoded)
 
 		return nil
 	})
@@ -63,20 +197,40 @@ func (s *State) WriteConfig(ctx context.Context, allow bool) error {
 	return err
 }
 
-func (s *State) ReadConfig(ctx context.Context) (bool, error) {
+func (s *State) ReadConfig(ctx context.Context) (*StateRecord, error) {
 	configMap := v1.ConfigMap{}
 	err := s.Get(ctx, s.ref, &configMap)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// if no state is found, assume we're serving requests
-			return true, nil
+			return &StateRecord{Level: LevelOpen}, nil
+		}
+		return nil, err
+	}
+
+	return parseState(configMap.Data), nil
+}
+
+// parseState reads a StateRecord from the data of the state ConfigMap,
+// falling back to the keys written by older versions.
+func parseState(data map[string]string) *StateRecord {
+	if encoded, ok := data[STATE_KEY]; ok {
+		record := StateRecord{}
+		err := json.Unmarshal([]byte(encoded), &record)
+		if _, known := ParseLevel(string(record.Level)); err == nil && known {
+			return &record
+		}
+	}
+
+	if encoded, ok := data[LEVEL_KEY]; ok {
+		if level, ok := ParseLevel(encoded); ok {
+			return &StateRecord{Level: level}
 		}
-		return false, err
 	}
 
-	data, ok := configMap.Data[CONFIG_KEY]
-	if !ok {
-		return true, nil
+	allow, ok := data[CONFIG_KEY]
+	if !ok || allow == "1" {
+		return &StateRecord{Level: LevelOpen}
 	}
-	return data == "1", nil
+	return &StateRecord{Level: LevelClosed}
 }
@@ -16,6 +16,7 @@ package etcd_shield_test
 
 import (
 	"context"
+	"time"
 
 	etcd_shield "github.com/konflux-ci/etcd-shield/pkg"
 	. "github.com/onsi/ginkgo/v2"
@@ -43,9 +44,9 @@ var _ = Describe("Pkg/State/Read", func() {
 		Expect(err).NotTo(HaveOccurred())
 
 		state := etcd_shield.NewState(client, types.NamespacedName{Name: configmap.Name, Namespace: configmap.Namespace})
-		allowed, err := state.ReadConfig(ctx)
+		record, err := state.ReadConfig(ctx)
 		Expect(err).NotTo(HaveOccurred())
-		Expect(allowed).To(BeTrue())
+		Expect(record.Level).To(Equal(etcd_shield.LevelOpen))
 	})
 
 	It("Should read a false state from the configmap", func(ctx context.Context) {
@@ -58,16 +59,81 @@ var _ = Describe("Pkg/State/Read", func() {
 		Expect(err).NotTo(HaveOccurred())
 
 		state := etcd_shield.NewState(client, types.NamespacedName{Name: configmap.Name, Namespace: configmap.Namespace})
-		allowed, err := state.ReadConfig(ctx)
+		record, err := state.ReadConfig(ctx)
 		Expect(err).NotTo(HaveOccurred())
-		Expect(allowed).To(BeFalse())
+		Expect(record.Level).To(Equal(etcd_shield.LevelClosed))
+	})
+
+	It("Should prefer the level over the legacy allow key", func(ctx context.Context) {
+		configmap := v1.ConfigMap{
+			Data: map[string]string{
+				etcd_shield.CONFIG_KEY: "0",
+				etcd_shield.LEVEL_KEY:  string(etcd_shield.LevelThrottled),
+			},
+		}
+		configmap.SetName("state")
+		configmap.SetNamespace("etcd-shield")
+		err := client.Create(ctx, &configmap)
+		Expect(err).NotTo(HaveOccurred())
+
+		state := etcd_shield.NewState(client, types.NamespacedName{Name: configmap.Name, Namespace: configmap.Namespace})
+		record, err := state.ReadConfig(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(record.Level).To(Equal(etcd_shield.LevelThrottled))
+	})
+
+	It("Should read a state record from the configmap", func(ctx context.Context) {
+		configmap := v1.ConfigMap{
+			Data: map[string]string{
+				etcd_shield.CONFIG_KEY: "0",
+				etcd_shield.LEVEL_KEY:  string(etcd_shield.LevelClosed),
+				etcd_shield.STATE_KEY: `{"version":1,"level":"closed","reason":"alert foo is firing","signal":"foo",` +
+					`"values":{"foo":1},"lastTransitionTime":"2025-01-02T03:04:05Z",` +
+					`"lastCheckTime":"2025-01-02T03:05:05Z","writer":"etcd-shield-abc"}`,
+			},
+		}
+		configmap.SetName("state")
+		configmap.SetNamespace("etcd-shield")
+		err := client.Create(ctx, &configmap)
+		Expect(err).NotTo(HaveOccurred())
+
+		state := etcd_shield.NewState(client, types.NamespacedName{Name: configmap.Name, Namespace: configmap.Namespace})
+		record, err := state.ReadConfig(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(record.Version).To(Equal(1))
+		Expect(record.Level).To(Equal(etcd_shield.LevelClosed))
+		Expect(record.Reason).To(Equal("alert foo is firing"))
+		Expect(record.Signal).To(Equal("foo"))
+		Expect(record.Values).To(HaveKeyWithValue("foo", 1.0))
+		Expect(record.LastTransitionTime.UTC()).To(Equal(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)))
+		Expect(record.LastCheckTime.UTC()).To(Equal(time.Date(2025, 1, 2, 3, 5, 5, 0, time.UTC)))
+		Expect(record.Writer).To(Equal("etcd-shield-abc"))
+	})
+
+	It("Should fall back to the legacy keys if the state record is unreadable", func(ctx context.Context) {
+		configmap := v1.ConfigMap{
+			Data: map[string]string{
+				etcd_shield.CONFIG_KEY: "0",
+				etcd_shield.STATE_KEY:  "not json",
+			},
+		}
+		configmap.SetName("state")
+		configmap.SetNamespace("etcd-shield")
+		err := client.Create(ctx, &configmap)
+		Expect(err).NotTo(HaveOccurred())
+
+		state := etcd_shield.NewState(client, types.NamespacedName{Name: configmap.Name, Namespace: configmap.Namespace})
+		record, err := state.ReadConfig(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(record.Version).To(Equal(0))
+		Expect(record.Level).To(Equal(etcd_shield.LevelClosed))
 	})
 
 	It("Should assume a default of true if the configmap isn't found", func(ctx context.Context) {
 		state := etcd_shield.NewState(client, types.NamespacedName{Name: "state", Namespace: "etcd-shield"})
-		allowed, err := state.ReadConfig(ctx)
+		record, err := state.ReadConfig(ctx)
 		Expect(err).NotTo(HaveOccurred())
-		Expect(allowed).To(BeTrue())
+		Expect(record.Level).To(Equal(etcd_shield.LevelOpen))
 	})
 })
 
@@ -89,19 +155,27 @@ var _ = Describe("Pkg/State/Write", func() {
 		Expect(err).NotTo(HaveOccurred())
 	}
 
-	DescribeTable("write state", func(setup func(), allowed bool) {
+	DescribeTable("write state", func(setup func(), level etcd_shield.Level, allow string) {
 		setup()
 		state := etcd_shield.NewState(client, ref)
-		err := state.WriteConfig(context.Background(), allowed)
+		err := state.WriteConfig(context.Background(), &etcd_shield.StateRecord{Level: level})
 		Expect(err).NotTo(HaveOccurred())
 
 		read_state, err := state.ReadConfig(context.Background())
 		Expect(err).NotTo(HaveOccurred())
-		Expect(read_state).To(BeEquivalentTo(allowed))
+		Expect(read_state.Level).To(Equal(level))
+		Expect(read_state.Version).To(Equal(etcd_shield.STATE_VERSION))
+
+		configmap := v1.ConfigMap{}
+		err = client.Get(context.Background(), ref, &configmap)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(configmap.Data).To(HaveKeyWithValue(etcd_shield.CONFIG_KEY, allow))
 	},
-		Entry("existing configmap", exist, true),
-		Entry("existing configmap", exist, false),
-		Entry("non-existing configmap", func() {}, true),
-		Entry("non-existing configmap", func() {}, false),
+		Entry("existing configmap", exist, etcd_shield.LevelOpen, "1"),
+		Entry("existing configmap", exist, etcd_shield.LevelThrottled, "0"),
+		Entry("existing configmap", exist, etcd_shield.LevelClosed, "0"),
+		Entry("non-existing configmap", func() {}, etcd_shield.LevelOpen, "1"),
+		Entry("non-existing configmap", func() {}, etcd_shield.LevelThrottled, "0"),
+		Entry("non-existing configmap", func() {}, etcd_shield.LevelClosed, "0"),
 	)
 })
@@ -17,7 +17,11 @@ package etcd_shield
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 // Duration is a wrapper around time.Duration that can be safely marshalled to
@@ -56,3 +60,78 @@ func (d *Duration) UnmarshalJSON(b []byte) error {
 		return fmt.Errorf("invalid duration")
 	}
 }
+
+// Threshold is a value that can be given as a plain number, as a quantity such
+// as "7Gi", or as a percentage of etcd's quota such as "95%".
+type Threshold struct {
+	// Value is the threshold itself, or the percentage if Percent is set.
+	Value float64
+	// Percent is set when Value is a percentage of the quota.
+	Percent bool
+}
+
+func NewThreshold(value float64) Threshold {
+	return Threshold{Value: value}
+}
+
+func NewPercentThreshold(percent float64) Threshold {
+	return Threshold{Value: percent, Percent: true}
+}
+
+// IsZero indicates whether the threshold is unset.
+func (t Threshold) IsZero() bool {
+	return t == Threshold{}
+}
+
+// Resolve returns the threshold's value, given etcd's quota.
+func (t Threshold) Resolve(quota float64) float64 {
+	if t.Percent {
+		return quota * t.Value / 100
+	}
+	return t.Value
+}
+
+func (t Threshold) String() string {
+	if t.Percent {
+		return strconv.FormatFloat(t.Value, 'g', -1, 64) + "%"
+	}
+	return strconv.FormatFloat(t.Value, 'g', -1, 64)
+}
+
+func (t Threshold) MarshalJSON() ([]byte, error) {
+	if t.Percent {
+		return json.Marshal(t.String())
+	}
+	return json.Marshal(t.Value)
+}
+
+func (t *Threshold) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	err := json.Unmarshal(b, &v)
+	if err != nil {
+		return err
+	}
+
+	switch value := v.(type) {
+	case float64:
+		*t = NewThreshold(value)
+		return nil
+	case string:
+		if percent, ok := strings.CutSuffix(strings.TrimSpace(value), "%"); ok {
+			p, err := strconv.ParseFloat(strings.TrimSpace(percent), 64)
+			if err != nil {
+				return fmt.Errorf("invalid percentage %q", value)
+			}
+			*t = NewPercentThreshold(p)
+			return nil
+		}
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return fmt.Errorf("invalid threshold %q: %w", value, err)
+		}
+		*t = NewThreshold(quantity.AsApproximateFloat64())
+		return nil
+	default:
+		return fmt.Errorf("invalid threshold")
+	}
+}
@@ -17,39 +17,329 @@ package etcd_shield
 import (
 	"context"
 	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
 
+	"github.com/go-logr/logr"
+	tektonv1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
+// QUEUED_LABEL marks `PipelineRuns` that were made pending by the webhook, so
+// only those are released once admission reopens.
+const QUEUED_LABEL string = "etcd-shield.konflux-ci.dev/queued"
+
+// pipelineRunKind is the kind of the typed objects the Webhook defaults.
+var pipelineRunKind = tektonv1.SchemeGroupVersion.WithKind("PipelineRun")
+
 type Webhook struct {
-	state StateManager
+	state    StateManager
+	client   client.Reader
+	settings atomic.Pointer[webhookSettings]
+	budget   budget
 }
 
-func NewWebhook(state StateManager) admission.CustomValidator {
-	return &Webhook{
-		state: state,
+// webhookSettings is everything the Webhook swaps out when the config is
+// reloaded.
+type webhookSettings struct {
+	resources  map[schema.GroupVersionKind]*ResourceConfig
+	exemptions *Exemptions
+	throttle   *ThrottleConfig
+	queue      QueueConfig
+	staleness  StalenessConfig
+	denial     DenialConfig
+	statusURL  *template.Template
+}
+
+// NewWebhook creates the admission webhook, which validates through the
+// Handler for each guarded resource and, when queueing is enabled, defaults
+// `PipelineRuns`.  The client is used to look up namespaces for exemptions.
+func NewWebhook(state StateManager, cfg Config, cli client.Reader) (*Webhook, error) {
+	webhook := Webhook{
+		state:  state,
+		client: cli,
+	}
+	settings, err := webhook.newSettings(&cfg)
+	if err != nil {
+		return nil, err
 	}
+	webhook.settings.Store(settings)
+
+	return &webhook, nil
 }
 
-var _ admission.CustomValidator = &Webhook{}
+var _ admission.CustomDefaulter = &Webhook{}
+var _ Reloader = &Webhook{}
+
+func (w *Webhook) newSettings(cfg *Config) (*webhookSettings, error) {
+	exemptions, err := NewExemptions(w.client, cfg.Exemptions)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := map[schema.GroupVersionKind]*ResourceConfig{}
+	for i := range cfg.Resources {
+		resources[cfg.Resources[i].GroupVersionKind()] = &cfg.Resources[i]
+	}
 
-func (w *Webhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
-	allow, err := w.state.ReadConfig(ctx)
+	statusURL, err := parseStatusURL(cfg.Denial.StatusURL)
 	if err != nil {
 		return nil, err
-	} else if !allow {
-		return nil, fmt.Errorf("PipelineRun admission currently not allowed")
 	}
-	return nil, nil
+
+	return &webhookSettings{
+		denial:     cfg.Denial,
+		statusURL:  statusURL,
+		resources:  resources,
+		exemptions: exemptions,
+		throttle:   cfg.Throttle,
+		queue:      cfg.Queue,
+		staleness:  cfg.Staleness,
+	}, nil
+}
+
+// PrepareReload builds the webhook's settings from cfg, and swaps them in once
+// committed.
+func (w *Webhook) PrepareReload(cfg *Config) (func(), func(), error) {
+	settings, err := w.newSettings(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return func() { w.settings.Store(settings) }, nil, nil
+}
+
+// Default queues new `PipelineRuns` by marking them as pending while admission
+// is closed, so they're run once it reopens instead of being rejected.
+func (w *Webhook) Default(ctx context.Context, obj runtime.Object) error {
+	pr, ok := obj.(*tektonv1.PipelineRun)
+	if !ok {
+		return fmt.Errorf("expected a PipelineRun but got %T", obj)
+	}
+	settings := w.settings.Load()
+	if !settings.queue.Enabled || pr.IsPending() {
+		// pending PipelineRuns are already being held back by someone else
+		return nil
+	}
+	resource := settings.resources[pipelineRunKind]
+	if enforcementOf(resource) != EnforcementEnforce {
+		// queueing would hold back PipelineRuns we're only meant to report on
+		return nil
+	}
+
+	exempt, err := settings.exemptions.IsExempt(ctx, pr)
+	if err != nil {
+		recordDecision(pr.Namespace, OutcomeError)
+		return err
+	} else if exempt {
+		return nil
+	}
+
+	level, _, _, err := w.level(ctx, settings)
+	if err != nil {
+		recordDecision(pr.Namespace, OutcomeError)
+		return err
+	} else if resource.levelFor(level) != LevelClosed {
+		// queue exactly what validation would deny as closed
+		return nil
+	}
+
+	recordDecision(pr.Namespace, OutcomeQueued)
+	pr.Spec.Status = tektonv1.PipelineRunSpecStatusPending
+	if pr.Labels == nil {
+		pr.Labels = map[string]string{}
+	}
+	pr.Labels[QUEUED_LABEL] = "true"
+	return nil
+}
+
+// validate admits or denies accessor, a new object of resource, which is nil if
+// no resource is configured for it.  Queued objects are `PipelineRuns` being
+// held back by the queue.
+func (w *Webhook) validate(ctx context.Context, settings *webhookSettings, resource *ResourceConfig, accessor metav1.Object, queued bool) (admission.Warnings, error) {
+	d, warnings, err := w.decide(ctx, settings, resource, accessor, queued)
+	if err != nil {
+		recordDecision(accessor.GetNamespace(), OutcomeError)
+		return warnings, err
+	}
+
+	outcome := d.outcome
+	denial := settings.deny(ctx, resource, d, accessor)
+
+	if mode := enforcementOf(resource); denial != nil && mode != EnforcementEnforce {
+		logr.FromContextOrDiscard(ctx).Info("not enforcing admission decision", "enforcement", mode,
+			"kind", kindOf(resource), "namespace", accessor.GetNamespace(), "name", objectName(accessor),
+			"outcome", outcome, "reason", denial.Error())
+		recordUnenforced(accessor.GetNamespace(), outcome, mode)
+		if mode == EnforcementWarn {
+			warnings = append(warnings, "etcd-shield would have denied this: "+denial.Error())
+		}
+		outcome, denial = OutcomeAllowed, nil
+	}
+
+	if outcome != OutcomeQueued {
+		// queued PipelineRuns were already counted by Default
+		recordDecision(accessor.GetNamespace(), outcome)
+	}
+	return warnings, denial
+}
+
+// decision is how admitting an object was decided.
+type decision struct {
+	outcome string
+	// record is the state record the decision was based on, which is nil if
+	// the object is exempt.
+	record *StateRecord
+	// level is the level enforced, after applying the staleness policy and
+	// the resource's level overrides to record's.
+	level Level
+	// stale explains why the staleness policy replaced record's level, if it
+	// did.
+	stale string
+	// overridden is the level the resource's level overrides replaced, if
+	// they did.
+	overridden Level
+}
+
+// decide determines how admitting accessor is decided.
+func (w *Webhook) decide(ctx context.Context, settings *webhookSettings, resource *ResourceConfig, accessor metav1.Object, queued bool) (decision, admission.Warnings, error) {
+	exempt, err := settings.exemptions.IsExempt(ctx, accessor)
+	if err != nil {
+		return decision{}, nil, err
+	} else if exempt {
+		return decision{outcome: OutcomeExempt}, nil, nil
+	}
+
+	level, record, warning, err := w.level(ctx, settings)
+	if err != nil {
+		return decision{}, nil, err
+	}
+	d := decision{record: record, level: level}
+	var warnings admission.Warnings
+	if warning != "" {
+		warnings = admission.Warnings{warning}
+		if level != record.Level {
+			d.stale = warning
+		}
+	}
+	if override := resource.levelFor(level); override != level {
+		d.level, d.overridden = override, level
+	}
+
+	if d.level == LevelClosed && settings.queue.Enabled && queued {
+		// queued PipelineRuns don't run until we release them
+		d.outcome = OutcomeQueued
+		return d, warnings, nil
+	}
+
+	switch d.level {
+	case LevelOpen:
+		d.outcome = OutcomeAllowed
+		// only ramp up if the querier reopened admission, not the staleness policy
+		ramp := record.Ramp
+		if record.Level == LevelOpen && ramp != nil && hashFraction(accessor.GetNamespace(), objectName(accessor)) >= ramp.Fraction(time.Now()) {
+			d.outcome = OutcomeRamping
+		}
+	case LevelThrottled:
+		d.outcome = OutcomeAllowed
+		if !w.admitThrottled(settings.throttle, accessor) {
+			d.outcome = OutcomeThrottled
+		}
+	default:
+		d.outcome = OutcomeDenied
+	}
+	return d, warnings, nil
+}
+
+// level reads the level to enforce, applying the staleness policy, along with
+// the record it's read from.  If the state is stale, the returned warning says
+// so.
+func (w *Webhook) level(ctx context.Context, settings *webhookSettings) (Level, *StateRecord, string, error) {
+	record, err := w.state.ReadConfig(ctx)
+	if err != nil {
+		return "", nil, "", err
+	}
+
+	level, warning := EffectiveLevel(record, settings.staleness, time.Now())
+	if warning != "" {
+		logr.FromContextOrDiscard(ctx).Info("state is stale", "warning", warning)
+	}
+	return level, record, warning, nil
+}
+
+// admitThrottled decides whether obj is one of the `PipelineRuns` we let in
+// while throttled.
+func (w *Webhook) admitThrottled(throttle *ThrottleConfig, obj metav1.Object) bool {
+	if throttle == nil {
+		// throttled without any limits configured, so nothing to let in
+		return false
+	}
+
+	if throttle.Fraction > 0 && hashFraction(obj.GetNamespace(), objectName(obj)) >= throttle.Fraction {
+		return false
+	}
+	if throttle.Budget > 0 && !w.budget.take(time.Now(), throttle.Budget, throttle.Period.Duration) {
+		return false
+	}
+	return true
+}
+
+// isQueued reports whether a `PipelineRun` with labels and spec status is
+// being held back by the queue.
+func isQueued(labels map[string]string, status string) bool {
+	return status == string(tektonv1.PipelineRunSpecStatusPending) && labels[QUEUED_LABEL] == "true"
 }
 
-func (*Webhook) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
-	// we don't care about validating deletes
-	return nil, nil
+// objectName is the name obj is hashed by, which is its generateName if it
+// isn't named yet.
+func objectName(obj metav1.Object) string {
+	if name := obj.GetName(); name != "" {
+		return name
+	}
+	return obj.GetGenerateName()
+}
+
+// hashFraction maps namespace/name onto [0, 1), so the same object is always
+// treated the same way.  It's FNV-1a, inlined so admission doesn't allocate.
+func hashFraction(namespace, name string) float64 {
+	const offset32, prime32 = 2166136261, 16777619
+	var h uint32 = offset32
+	for i := 0; i < len(namespace); i++ {
+		h = (h ^ uint32(namespace[i])) * prime32
+	}
+	h = (h ^ '/') * prime32
+	for i := 0; i < len(name); i++ {
+		h = (h ^ uint32(name[i])) * prime32
+	}
+	return float64(h) / (math.MaxUint32 + 1)
 }
 
-func (*Webhook) ValidateUpdate(context.Context, runtime.Object, runtime.Object) (admission.Warnings, error) {
-	// we don't care about validating updates
-	return nil, nil
+// budget counts admissions in fixed windows of time.
+type budget struct {
+	mu          sync.Mutex
+	windowStart time.Time
+	used        int
+}
+
+// take consumes one admission from the budget, reporting false if the current
+// window is already used up.
+func (b *budget) take(now time.Time, limit int, period time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if now.Sub(b.windowStart) >= period {
+		b.windowStart = now
+		b.used = 0
+	}
+	if b.used >= limit {
+		return false
+	}
+	b.used++
+	return true
 }
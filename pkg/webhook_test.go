@@ -0,0 +1,272 @@
+// Copyright 2025 Red Hat Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_shield_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	etcd_shield "github.com/konflux-ci/etcd-shield/pkg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	tektonv1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func pipelineRun(namespace, name string) *tektonv1.PipelineRun {
+	pr := &tektonv1.PipelineRun{}
+	pr.SetNamespace(namespace)
+	pr.SetName(name)
+	return pr
+}
+
+// create asks webhook to admit creating pr, the way the API server would.
+func create(ctx context.Context, webhook *etcd_shield.Webhook, pr *tektonv1.PipelineRun) admission.Response {
+	return webhook.Handler(pipelineRunGVK).Handle(ctx, pipelineRunRequest(pr))
+}
+
+var _ = Describe("Pkg/Webhook", func() {
+	var cli client.Client
+	var state etcd_shield.StateManager
+
+	BeforeEach(func() {
+		cli = fake.NewClientBuilder().Build()
+		state = etcd_shield.NewState(cli, types.NamespacedName{Name: "state", Namespace: "etcd-shield"})
+	})
+
+	newWebhook := func(cfg etcd_shield.Config) *etcd_shield.Webhook {
+		webhook, err := etcd_shield.NewWebhook(state, cfg, cli)
+		Expect(err).NotTo(HaveOccurred())
+		return webhook
+	}
+
+	// admitted counts how many of n distinct PipelineRuns the webhook lets in
+	admitted := func(ctx context.Context, cfg etcd_shield.Config, n int) int {
+		webhook := newWebhook(cfg)
+		count := 0
+		for i := 0; i < n; i++ {
+			if create(ctx, webhook, pipelineRun("tenant", fmt.Sprintf("build-%d", i))).Allowed {
+				count++
+			}
+		}
+		return count
+	}
+
+	It("Should admit everything while open", func(ctx context.Context) {
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelOpen})).To(Succeed())
+		Expect(admitted(ctx, etcd_shield.Config{}, 100)).To(Equal(100))
+	})
+
+	It("Should deny everything while closed", func(ctx context.Context) {
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelClosed})).To(Succeed())
+		Expect(admitted(ctx, etcd_shield.Config{}, 100)).To(Equal(0))
+	})
+
+	It("Should admit a fraction of PipelineRuns while throttled", func(ctx context.Context) {
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelThrottled})).To(Succeed())
+		cfg := etcd_shield.Config{Throttle: &etcd_shield.ThrottleConfig{Fraction: 0.25}}
+		Expect(admitted(ctx, cfg, 1000)).To(BeNumerically("~", 250, 50))
+	})
+
+	It("Should consistently admit the same PipelineRun while throttled", func(ctx context.Context) {
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelThrottled})).To(Succeed())
+		webhook := newWebhook(etcd_shield.Config{Throttle: &etcd_shield.ThrottleConfig{Fraction: 0.5}})
+		first := create(ctx, webhook, pipelineRun("tenant", "build")).Allowed
+		for i := 0; i < 10; i++ {
+			Expect(create(ctx, webhook, pipelineRun("tenant", "build")).Allowed).To(Equal(first))
+		}
+	})
+
+	It("Should admit up to the budget while throttled", func(ctx context.Context) {
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelThrottled})).To(Succeed())
+		cfg := etcd_shield.Config{Throttle: &etcd_shield.ThrottleConfig{
+			Budget: 5,
+			Period: etcd_shield.NewDuration(time.Hour),
+		}}
+		Expect(admitted(ctx, cfg, 100)).To(Equal(5))
+	})
+
+	It("Should admit a growing fraction of PipelineRuns while ramping up", func(ctx context.Context) {
+		ramp := &etcd_shield.RampState{
+			Start:           metav1.NewTime(time.Now().Add(-90 * time.Second)),
+			Duration:        etcd_shield.NewDuration(9 * time.Minute),
+			Mode:            etcd_shield.RampLinear,
+			InitialFraction: 0.1,
+		}
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelOpen, Ramp: ramp})).To(Succeed())
+		Expect(admitted(ctx, etcd_shield.Config{}, 1000)).To(BeNumerically("~", 250, 50))
+
+		ramp.Start = metav1.NewTime(time.Now().Add(-time.Hour))
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelOpen, Ramp: ramp})).To(Succeed())
+		Expect(admitted(ctx, etcd_shield.Config{}, 100)).To(Equal(100))
+	})
+
+	It("Should explain denials with a structured status", func(ctx context.Context) {
+		closedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{
+			Level:              etcd_shield.LevelClosed,
+			Reason:             "alert EtcdDBSizeHigh is firing",
+			Signal:             "EtcdDBSizeHigh",
+			Values:             map[string]float64{"quota": 8589934592, "query": 8.2e9},
+			LastTransitionTime: metav1.NewTime(closedAt),
+		})).To(Succeed())
+		webhook := newWebhook(etcd_shield.Config{Denial: etcd_shield.DenialConfig{
+			Code:       http.StatusServiceUnavailable,
+			RetryAfter: etcd_shield.NewDuration(90 * time.Second),
+			StatusURL:  "https://status.example.com/etcd?level={{.Level}}&ns={{.Namespace}}",
+		}})
+
+		response := create(ctx, webhook, pipelineRun("tenant", "build"))
+		Expect(response.Allowed).To(BeFalse())
+		status := response.Result
+		Expect(status.Code).To(BeEquivalentTo(http.StatusServiceUnavailable))
+		Expect(status.Reason).To(Equal(metav1.StatusReasonServiceUnavailable))
+		Expect(status.Message).To(Equal("PipelineRun admission currently not allowed: alert EtcdDBSizeHigh is firing, " +
+			"closed since 2025-01-02T03:04:05Z; see https://status.example.com/etcd?level=closed&ns=tenant"))
+		Expect(status.Details.RetryAfterSeconds).To(BeEquivalentTo(90))
+		Expect(status.Details.Causes).To(Equal([]metav1.StatusCause{
+			{Type: etcd_shield.CauseLevel, Message: "closed"},
+			{Type: etcd_shield.CauseSignal, Message: "EtcdDBSizeHigh"},
+			{Type: etcd_shield.CauseValue, Field: "query", Message: "8.2e+09"},
+			{Type: etcd_shield.CauseValue, Field: "quota", Message: "8.589934592e+09"},
+			{Type: etcd_shield.CauseSince, Message: "2025-01-02T03:04:05Z"},
+			{Type: etcd_shield.CauseStatusURL, Message: "https://status.example.com/etcd?level=closed&ns=tenant"},
+		}))
+	})
+
+	It("Should deny with 429 by default", func(ctx context.Context) {
+		Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelClosed})).To(Succeed())
+		response := create(ctx, newWebhook(etcd_shield.Config{}), pipelineRun("tenant", "build"))
+		Expect(response.Allowed).To(BeFalse())
+		Expect(response.Result.Code).To(BeEquivalentTo(http.StatusTooManyRequests))
+		Expect(response.Result.Reason).To(Equal(metav1.StatusReasonTooManyRequests))
+	})
+
+	Context("With exemptions", func() {
+		var webhook *etcd_shield.Webhook
+
+		BeforeEach(func(ctx context.Context) {
+			Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{Level: etcd_shield.LevelClosed})).To(Succeed())
+
+			release := corev1.Namespace{}
+			release.SetName("release")
+			Expect(cli.Create(ctx, &release)).To(Succeed())
+
+			infra := corev1.Namespace{}
+			infra.SetName("infra")
+			infra.SetLabels(map[string]string{"konflux-ci.dev/type": "platform"})
+			Expect(cli.Create(ctx, &infra)).To(Succeed())
+
+			tenant := corev1.Namespace{}
+			tenant.SetName("tenant")
+			Expect(cli.Create(ctx, &tenant)).To(Succeed())
+
+			webhook = newWebhook(etcd_shield.Config{
+				Exemptions: etcd_shield.ExemptionConfig{
+					Namespaces: []string{"release"},
+					NamespaceSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"konflux-ci.dev/type": "platform"},
+					},
+					ObjectSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{"konflux-ci.dev/priority": "high"},
+					},
+					Annotations: map[string]string{"konflux-ci.dev/exempt": "true"},
+				},
+			})
+		})
+
+		It("Should admit PipelineRuns in exempt namespaces", func(ctx context.Context) {
+			Expect(create(ctx, webhook, pipelineRun("release", "build")).Allowed).To(BeTrue())
+		})
+
+		It("Should admit PipelineRuns in namespaces matching the selector", func(ctx context.Context) {
+			Expect(create(ctx, webhook, pipelineRun("infra", "build")).Allowed).To(BeTrue())
+		})
+
+		It("Should admit PipelineRuns matching the object selector", func(ctx context.Context) {
+			pr := pipelineRun("tenant", "build")
+			pr.SetLabels(map[string]string{"konflux-ci.dev/priority": "high"})
+			Expect(create(ctx, webhook, pr).Allowed).To(BeTrue())
+		})
+
+		It("Should admit PipelineRuns carrying an exempt annotation", func(ctx context.Context) {
+			pr := pipelineRun("tenant", "build")
+			pr.SetAnnotations(map[string]string{"konflux-ci.dev/exempt": "true"})
+			Expect(create(ctx, webhook, pr).Allowed).To(BeTrue())
+		})
+
+		It("Should deny PipelineRuns that aren't exempt", func(ctx context.Context) {
+			pr := pipelineRun("tenant", "build")
+			pr.SetAnnotations(map[string]string{"konflux-ci.dev/exempt": "false"})
+			Expect(create(ctx, webhook, pr).Allowed).To(BeFalse())
+		})
+	})
+
+	Context("With staleness detection", func() {
+		staleness := func(policy etcd_shield.StalePolicy) etcd_shield.Config {
+			return etcd_shield.Config{Staleness: etcd_shield.StalenessConfig{
+				MaxAge: etcd_shield.NewDuration(time.Minute),
+				Policy: policy,
+			}}
+		}
+		checkedAgo := func(ctx context.Context, level etcd_shield.Level, ago time.Duration) {
+			Expect(state.WriteConfig(ctx, &etcd_shield.StateRecord{
+				Level:         level,
+				LastCheckTime: metav1.NewTime(time.Now().Add(-ago)),
+			})).To(Succeed())
+		}
+
+		It("Should enforce fresh state without warnings", func(ctx context.Context) {
+			checkedAgo(ctx, etcd_shield.LevelClosed, 10*time.Second)
+			response := create(ctx, newWebhook(staleness(etcd_shield.StalePolicyFailOpen)), pipelineRun("tenant", "build"))
+			Expect(response.Allowed).To(BeFalse())
+			Expect(response.Warnings).To(BeEmpty())
+		})
+
+		It("Should fail open on stale state", func(ctx context.Context) {
+			checkedAgo(ctx, etcd_shield.LevelClosed, 10*time.Minute)
+			response := create(ctx, newWebhook(staleness(etcd_shield.StalePolicyFailOpen)), pipelineRun("tenant", "build"))
+			Expect(response.Allowed).To(BeTrue())
+			Expect(response.Warnings).To(ConsistOf(ContainSubstring("admitting PipelineRuns")))
+		})
+
+		It("Should fail closed on stale state", func(ctx context.Context) {
+			checkedAgo(ctx, etcd_shield.LevelOpen, 10*time.Minute)
+			response := create(ctx, newWebhook(staleness(etcd_shield.StalePolicyFailClosed)), pipelineRun("tenant", "build"))
+			Expect(response.Allowed).To(BeFalse())
+			Expect(response.Warnings).To(ConsistOf(ContainSubstring("denying PipelineRuns")))
+		})
+
+		It("Should keep the last state when stale", func(ctx context.Context) {
+			checkedAgo(ctx, etcd_shield.LevelClosed, 10*time.Minute)
+			response := create(ctx, newWebhook(staleness(etcd_shield.StalePolicyKeepLast)), pipelineRun("tenant", "build"))
+			Expect(response.Allowed).To(BeFalse())
+			Expect(response.Warnings).To(ConsistOf(ContainSubstring("keeping the last admission level of closed")))
+		})
+
+		It("Should treat missing state as stale", func(ctx context.Context) {
+			response := create(ctx, newWebhook(staleness(etcd_shield.StalePolicyFailClosed)), pipelineRun("tenant", "build"))
+			Expect(response.Allowed).To(BeFalse())
+			Expect(response.Warnings).To(ConsistOf(ContainSubstring("never been refreshed")))
+		})
+	})
+})